@@ -0,0 +1,122 @@
+package chatgpt
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mitchellh/go-homedir"
+	"github.com/zalando/go-keyring"
+)
+
+// KeyringService is the service name of the API key stored in the OS keyring.
+const KeyringService = "chatgpt"
+
+const apiKeyCommandTimeout = time.Minute
+
+var (
+	apiKeyCacheMu sync.Mutex
+	// apiKeyCache caches resolved keys by their source, so commands are run once per session.
+	apiKeyCache = map[string]string{}
+)
+
+// resolveAPIKey reads the API key from api_key_command, api_key_file or the keyring, whichever is set first.
+func resolveAPIKey(conf GlobalConfig) (string, error) {
+	var (
+		source string
+		read   func() (string, error)
+	)
+	switch {
+	case conf.APIKeyCommand != "":
+		source, read = "command:"+conf.APIKeyCommand, func() (string, error) { return apiKeyFromCommand(conf.APIKeyCommand) }
+	case conf.APIKeyFile != "":
+		source, read = "file:"+conf.APIKeyFile, func() (string, error) { return apiKeyFromFile(conf.APIKeyFile) }
+	case conf.APIKeyKeyring != "":
+		source, read = "keyring:"+conf.APIKeyKeyring, func() (string, error) { return apiKeyFromKeyring(conf.APIKeyKeyring) }
+	default:
+		return "", nil
+	}
+
+	apiKeyCacheMu.Lock()
+	defer apiKeyCacheMu.Unlock()
+	if key, ok := apiKeyCache[source]; ok {
+		return key, nil
+	}
+	key, err := read()
+	if err != nil {
+		return "", err
+	}
+	apiKeyCache[source] = key
+	return key, nil
+}
+
+func apiKeyFromCommand(command string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), apiKeyCommandTimeout)
+	defer cancel()
+	sh, flag := Shell()
+	cmd := exec.CommandContext(ctx, sh, flag, command)
+	var stdout bytes.Buffer
+	cmd.Stdout = &stdout
+	// Let password managers prompt on the terminal.
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() != nil {
+			err = fmt.Errorf("timed out after %s", apiKeyCommandTimeout)
+		}
+		// Not wrapped, the exit status of the command isn't ours.
+		return "", fmt.Errorf("failed to run api_key_command `%s`: %v", command, err)
+	}
+	// Only the first line is used, `pass show` prints extra metadata after it.
+	key, _, _ := strings.Cut(strings.TrimSpace(stdout.String()), "\n")
+	key = strings.TrimSpace(key)
+	if key == "" {
+		return "", fmt.Errorf("api_key_command `%s` printed an empty key", command)
+	}
+	return key, nil
+}
+
+func apiKeyFromFile(path string) (string, error) {
+	path, _ = homedir.Expand(path)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read api_key_file: %w", err)
+	}
+	key := strings.TrimSpace(string(data))
+	if key == "" {
+		return "", fmt.Errorf("api_key_file %s is empty", path)
+	}
+	return key, nil
+}
+
+func apiKeyFromKeyring(user string) (string, error) {
+	key, err := keyring.Get(KeyringService, user)
+	if errors.Is(err, keyring.ErrNotFound) {
+		return "", fmt.Errorf(
+			"API key %q not found in the keyring, store it with `chatgpt config set-key %s`",
+			user,
+			user,
+		)
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to read API key from the keyring: %w", err)
+	}
+	return strings.TrimSpace(key), nil
+}
+
+// StoreAPIKey saves the API key in the OS keyring under the user name.
+func StoreAPIKey(user, key string) error {
+	key = strings.TrimSpace(key)
+	if key == "" {
+		return errors.New("empty API key")
+	}
+	if err := keyring.Set(KeyringService, user, key); err != nil {
+		return fmt.Errorf("failed to store API key in the keyring: %w", err)
+	}
+	return nil
+}
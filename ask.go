@@ -0,0 +1,245 @@
+package chatgpt
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+type EventType string
+
+const (
+	EventDelta      EventType = "delta"
+	EventToolCall   EventType = "tool_call"
+	EventToolResult EventType = "tool_result"
+	EventRetry      EventType = "retry"
+	// EventWarning reports a problem that doesn't stop the answer, like images of earlier questions left out.
+	EventWarning EventType = "warning"
+)
+
+// Event is emitted while the answer is being received.
+type Event struct {
+	Type     EventType `json:"type"`
+	Content  string    `json:"content,omitempty"`
+	ToolCall *ToolCall `json:"tool_call,omitempty"`
+	// Set for retry events, Content is the error of the failed attempt.
+	Attempt     int   `json:"attempt,omitempty"`
+	MaxAttempts int   `json:"max_attempts,omitempty"`
+	DelayMs     int64 `json:"delay_ms,omitempty"`
+}
+
+type AskOptions struct {
+	Images  []Image
+	OnEvent func(Event)
+	// IncludeUsage requests token usage in streaming mode. Endpoints that reject it are asked again without it.
+	IncludeUsage bool
+}
+
+// Result describes a completed answer.
+type Result struct {
+	Answer       string              `json:"answer"`
+	Model        string              `json:"model"`
+	FinishReason openai.FinishReason `json:"finish_reason"`
+	Usage        *openai.Usage       `json:"usage,omitempty"`
+	CostUSD      float64             `json:"cost_usd,omitempty"` // estimated from the usage and the model's prices
+	ToolCalls    []ToolCall          `json:"tool_calls,omitempty"`
+	StartedAt    time.Time           `json:"started_at"`
+	// FirstTokenMs is the latency of the first content or tool call received.
+	FirstTokenMs int64 `json:"first_token_ms"`
+	DurationMs   int64 `json:"duration_ms"`
+}
+
+func (r *Result) addUsage(u *openai.Usage) {
+	if u == nil {
+		return
+	}
+	if r.Usage == nil {
+		r.Usage = &openai.Usage{}
+	}
+	r.Usage.PromptTokens += u.PromptTokens
+	r.Usage.CompletionTokens += u.CompletionTokens
+	r.Usage.TotalTokens += u.TotalTokens
+}
+
+// Ask sends the question in the conversation, and returns the answer after tool calls are done.
+// The question and its answer are recorded in the conversation, unless the request fails.
+func (c *ChatGPT) Ask(conv *Conversation, question string, opts AskOptions) (*Result, error) {
+	emit := func(e Event) {
+		if opts.OnEvent != nil {
+			opts.OnEvent(e)
+		}
+	}
+	result := &Result{Model: conv.Config.Model, StartedAt: time.Now()}
+	conv.AddQuestion(question, opts.Images...)
+	for round := 0; ; round++ {
+		messages, err := conv.GetContextMessages()
+		var imagesErr *ImagesError
+		if errors.As(err, &imagesErr) {
+			if round == 0 {
+				emit(Event{Type: EventWarning, Content: imagesErr.Error()})
+			}
+			err = nil
+		}
+		if err != nil {
+			conv.DiscardPending()
+			return nil, err
+		}
+		req, err := c.newRequest(conv.Config, messages)
+		if err != nil {
+			conv.DiscardPending()
+			return nil, err
+		}
+		if req.Stream && opts.IncludeUsage {
+			req.StreamOptions = &openai.StreamOptions{IncludeUsage: true}
+		}
+		content, calls, err := c.ask(conv.Config, req, result, emit)
+		if err != nil && req.StreamOptions != nil && streamOptionsRejected(err) {
+			opts.IncludeUsage = false
+			req.StreamOptions = nil
+			content, calls, err = c.ask(conv.Config, req, result, emit)
+		}
+		if err != nil {
+			conv.DiscardPending()
+			return nil, err
+		}
+		if len(calls) == 0 {
+			conv.UpdatePending(content, true)
+			result.Answer = content
+			result.DurationMs = time.Since(result.StartedAt).Milliseconds()
+			if result.Usage != nil {
+				conf := c.config()
+				result.CostUSD = conf.ModelInfo(conv.Config.Model).Cost(*result.Usage)
+			}
+			return result, nil
+		}
+		conv.UpdatePending(content, false)
+		conv.AddToolCalls(calls)
+		for call := conv.NextToolCall(); call != nil; call = conv.NextToolCall() {
+			emit(Event{Type: EventToolCall, ToolCall: call})
+			var output string
+			if t, ok := c.tools.Get(call.Name); ok && t.SideEffect {
+				output = "error: this tool requires user confirmation, which is not available in one-time mode"
+			} else {
+				output = c.RunTool(call.ToolCall())
+			}
+			conv.SetToolResult(call.ID, output)
+			emit(Event{Type: EventToolResult, ToolCall: call})
+			result.ToolCalls = append(result.ToolCalls, *call)
+		}
+	}
+}
+
+// streamOptionsRejected reports whether the request failed because the endpoint doesn't support stream_options,
+// like older Azure API versions.
+func streamOptionsRejected(err error) bool {
+	var (
+		apiErr *openai.APIError
+		reqErr *openai.RequestError
+	)
+	switch {
+	case errors.As(err, &apiErr):
+		return apiErr.HTTPStatusCode == http.StatusBadRequest && strings.Contains(apiErr.Message, "stream_options")
+	case errors.As(err, &reqErr):
+		return reqErr.HTTPStatusCode == http.StatusBadRequest && strings.Contains(string(reqErr.Body), "stream_options")
+	}
+	return false
+}
+
+func (c *ChatGPT) ask(
+	conf ConversationConfig,
+	req openai.ChatCompletionRequest,
+	result *Result,
+	emit func(Event),
+) (content string, calls []openai.ToolCall, err error) {
+	firstToken := func() {
+		if result.FirstTokenMs == 0 {
+			result.FirstTokenMs = time.Since(result.StartedAt).Milliseconds()
+		}
+	}
+	onRetry := func(e RetryEvent) {
+		emit(
+			Event{
+				Type:        EventRetry,
+				Content:     e.Err.Error(),
+				Attempt:     e.Attempt,
+				MaxAttempts: e.MaxAttempts,
+				DelayMs:     e.Delay.Milliseconds(),
+			},
+		)
+	}
+	client, err := c.client(conf.Profile)
+	if err != nil {
+		return "", nil, err
+	}
+	ctx := context.Background()
+	if req.Stream {
+		stream, err := c.openStream(ctx, client, req, onRetry)
+		if err != nil {
+			return "", nil, err
+		}
+		defer stream.Close()
+		var sb strings.Builder
+		for {
+			resp, err := stream.Recv()
+			if err != nil {
+				if errors.Is(err, io.EOF) {
+					break
+				}
+				return "", nil, err
+			}
+			result.addUsage(resp.Usage)
+			if resp.Model != "" {
+				result.Model = resp.Model
+			}
+			if len(resp.Choices) == 0 {
+				continue
+			}
+			choice := resp.Choices[0]
+			if choice.FinishReason != "" {
+				result.FinishReason = choice.FinishReason
+			}
+			if choice.Delta.Content != "" || len(choice.Delta.ToolCalls) > 0 {
+				firstToken()
+			}
+			calls = mergeToolCalls(calls, choice.Delta.ToolCalls)
+			if choice.Delta.Content != "" {
+				sb.WriteString(choice.Delta.Content)
+				emit(Event{Type: EventDelta, Content: choice.Delta.Content})
+			}
+		}
+		content = sb.String()
+	} else {
+		var resp openai.ChatCompletionResponse
+		err := c.withRetry(
+			ctx, onRetry, func(ctx context.Context) error {
+				var err error
+				resp, err = client.CreateChatCompletion(ctx, req)
+				return err
+			},
+		)
+		if err != nil {
+			return "", nil, err
+		}
+		firstToken()
+		result.addUsage(&resp.Usage)
+		if resp.Model != "" {
+			result.Model = resp.Model
+		}
+		if len(resp.Choices) == 0 {
+			return "", nil, errors.New("no choices in response")
+		}
+		choice := resp.Choices[0]
+		result.FinishReason = choice.FinishReason
+		calls = mergeToolCalls(calls, choice.Message.ToolCalls)
+		content = choice.Message.Content
+		if content != "" {
+			emit(Event{Type: EventDelta, Content: content})
+		}
+	}
+	return content, finishToolCalls(calls), nil
+}
@@ -0,0 +1,212 @@
+package chatgpt
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// BatchRequest is a line of the batch input.
+type BatchRequest struct {
+	ID string `json:"id"`
+	// Prompt is a key of the predefined prompts or the prompt itself, System takes precedence over it.
+	Prompt      string   `json:"prompt,omitempty"`
+	System      string   `json:"system,omitempty"`
+	Content     string   `json:"content"`
+	Model       string   `json:"model,omitempty"`
+	Temperature *float32 `json:"temperature,omitempty"`
+	MaxTokens   int      `json:"max_tokens,omitempty"`
+}
+
+// BatchResult is a line of the batch output.
+type BatchResult struct {
+	ID           string              `json:"id"`
+	Answer       string              `json:"answer,omitempty"`
+	Model        string              `json:"model,omitempty"`
+	FinishReason openai.FinishReason `json:"finish_reason,omitempty"`
+	Usage        *openai.Usage       `json:"usage,omitempty"`
+	CostUSD      float64             `json:"cost_usd,omitempty"` // estimated from the usage and the model's prices
+	DurationMs   int64               `json:"duration_ms"`
+	Error        string              `json:"error,omitempty"`
+}
+
+type BatchOptions struct {
+	Concurrency int
+	// Done contains ids that are already processed, they are skipped.
+	Done map[string]bool
+	// OnResult is called after each line is processed.
+	OnResult func(BatchResult)
+}
+
+const maxBatchLine = 16 * 1024 * 1024
+
+// ReadBatchDone reads ids of the successfully processed lines from a previous batch output.
+func ReadBatchDone(r io.Reader) (map[string]bool, error) {
+	done := map[string]bool{}
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), maxBatchLine)
+	for scanner.Scan() {
+		var result BatchResult
+		if err := json.Unmarshal(scanner.Bytes(), &result); err != nil {
+			// The last line may be partially written when interrupted.
+			continue
+		}
+		if result.Error == "" {
+			done[result.ID] = true
+		}
+	}
+	return done, scanner.Err()
+}
+
+// RunBatch processes JSONL requests from in concurrently, and writes the results to out as JSONL.
+// Results are written in the order they complete.
+func (c *ChatGPT) RunBatch(ctx context.Context, conf ConversationConfig, in io.Reader, out io.Writer, opts BatchOptions) error {
+	if opts.Concurrency <= 0 {
+		opts.Concurrency = 1
+	}
+
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		writeErr error
+		enc      = json.NewEncoder(out)
+		sem      = make(chan struct{}, opts.Concurrency)
+	)
+	write := func(result BatchResult) {
+		mu.Lock()
+		defer mu.Unlock()
+		if err := enc.Encode(result); err != nil && writeErr == nil {
+			writeErr = err
+		}
+		if opts.OnResult != nil {
+			opts.OnResult(result)
+		}
+	}
+
+	scanner := bufio.NewScanner(in)
+	scanner.Buffer(make([]byte, 64*1024), maxBatchLine)
+	line := 0
+	for scanner.Scan() {
+		line++
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var req BatchRequest
+		err := json.Unmarshal(scanner.Bytes(), &req)
+		if req.ID == "" {
+			req.ID = "line-" + strconv.Itoa(line)
+		}
+		if opts.Done[req.ID] {
+			continue
+		}
+		if err != nil {
+			write(BatchResult{ID: req.ID, Error: fmt.Sprintf("invalid line %d: %v", line, err)})
+			continue
+		}
+
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			break
+		}
+		wg.Add(1)
+		go func() {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			result := c.runBatchRequest(ctx, conf, req)
+			// Interrupted requests are not written, so they are retried when resuming.
+			if ctx.Err() != nil {
+				return
+			}
+			write(result)
+		}()
+	}
+	wg.Wait()
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	if writeErr != nil {
+		return writeErr
+	}
+	return ctx.Err()
+}
+
+func (c *ChatGPT) runBatchRequest(ctx context.Context, conf ConversationConfig, req BatchRequest) BatchResult {
+	start := time.Now()
+	result := BatchResult{ID: req.ID}
+	globalConf := c.config()
+
+	if req.Prompt != "" {
+		conf.Prompt = req.Prompt
+		conf = globalConf.withPromptDefaults(conf)
+	}
+	if req.Model != "" {
+		conf.Model = req.Model
+	}
+	if req.Temperature != nil {
+		conf.Temperature = *req.Temperature
+	}
+	if req.MaxTokens > 0 {
+		conf.MaxTokens = req.MaxTokens
+	}
+	system := req.System
+	if system == "" {
+		system = globalConf.LookupPrompt(req.Prompt)
+	}
+	var messages []openai.ChatCompletionMessage
+	if system != "" {
+		messages = append(messages, openai.ChatCompletionMessage{Role: openai.ChatMessageRoleSystem, Content: system})
+	}
+	messages = append(messages, openai.ChatCompletionMessage{Role: openai.ChatMessageRoleUser, Content: req.Content})
+	chatReq := openai.ChatCompletionRequest{
+		Model:       conf.Model,
+		Messages:    messages,
+		MaxTokens:   conf.MaxTokens,
+		Temperature: conf.Temperature,
+		N:           1,
+	}
+	if err := c.prepareRequest(&chatReq); err != nil {
+		result.Error = err.Error()
+		return result
+	}
+
+	client, err := c.client(conf.Profile)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	var resp openai.ChatCompletionResponse
+	err = c.withRetry(
+		ctx, nil, func(ctx context.Context) error {
+			var err error
+			resp, err = client.CreateChatCompletion(ctx, chatReq)
+			return err
+		},
+	)
+	result.DurationMs = time.Since(start).Milliseconds()
+	if err == nil && len(resp.Choices) == 0 {
+		err = errors.New("no choices in response")
+	}
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	result.Answer = resp.Choices[0].Message.Content
+	result.Model = resp.Model
+	result.FinishReason = resp.Choices[0].FinishReason
+	result.Usage = &resp.Usage
+	result.CostUSD = globalConf.ModelInfo(conf.Model).Cost(resp.Usage)
+	return result
+}
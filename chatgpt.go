@@ -2,22 +2,52 @@ package chatgpt
 
 import (
 	"context"
-	"errors"
 	"fmt"
 	"io"
 	"regexp"
+	"sort"
+	"sync"
 
-	"github.com/avast/retry-go"
 	"github.com/sashabaranov/go-openai"
+
+	"github.com/j178/chatgpt/mcp"
+	"github.com/j178/chatgpt/tokenizer"
+	"github.com/j178/chatgpt/tools"
 )
 
+// maxToolRounds limits how many times the model can call tools for a single question.
+const maxToolRounds = 10
+
 type ChatGPT struct {
+	mu         sync.Mutex // guards globalConf and clients, which change when the config is reloaded
 	globalConf GlobalConfig
-	client     *openai.Client
-	stream     *openai.ChatCompletionStream
+	clients    map[string]*openai.Client // by profile
+	tools      *tools.Registry
+	mcpClients []*mcp.Client
+	onRetry    func(RetryEvent)
+
+	// streamMu guards the state of the answer being received, Recv is called from other goroutines than Send and
+	// Done.
+	streamMu  sync.Mutex
+	buffer    *streamBuffer
+	cancel    context.CancelFunc
+	toolCalls []openai.ToolCall
 }
 
-func NewChatGPT(conf GlobalConfig) *ChatGPT {
+// NewChatGPT creates a bot using the API settings of conf, conversations of other profiles get their own client.
+func NewChatGPT(conf GlobalConfig) (*ChatGPT, error) {
+	client, err := newClient(conf)
+	if err != nil {
+		return nil, err
+	}
+	return &ChatGPT{
+		globalConf: conf,
+		clients:    map[string]*openai.Client{conf.Conversation.Profile: client},
+		tools:      tools.Builtin(),
+	}, nil
+}
+
+func newClient(conf GlobalConfig) (*openai.Client, error) {
 	var cc openai.ClientConfig
 	switch conf.APIType {
 	case openai.APITypeOpenAI:
@@ -39,117 +69,269 @@ func NewChatGPT(conf GlobalConfig) *ChatGPT {
 			return regexp.MustCompile(`[.:]`).ReplaceAllString(model, "")
 		}
 	default:
-		panic(fmt.Sprintf("unknown API type: %s", conf.APIType))
+		return nil, fmt.Errorf("unknown API type: %s", conf.APIType)
 	}
 	cc.OrgID = conf.OrgID
-	client := openai.NewClientWithConfig(cc)
-	return &ChatGPT{globalConf: conf, client: client}
+	httpClient, err := newHTTPClient(conf.HTTP)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create HTTP client: %w", err)
+	}
+	cc.HTTPClient = rateLimitDoer{httpClient}
+	return openai.NewClientWithConfig(cc), nil
+}
+
+// client returns the client of the profile, it's created on first use.
+func (c *ChatGPT) client(profile string) (*openai.Client, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if client, ok := c.clients[profile]; ok {
+		return client, nil
+	}
+	conf, err := c.globalConf.WithProfile(profile)
+	if err != nil {
+		return nil, err
+	}
+	conf, err = conf.resolve()
+	if err != nil {
+		return nil, err
+	}
+	client, err := newClient(conf)
+	if err != nil {
+		return nil, err
+	}
+	c.clients[profile] = client
+	return client, nil
+}
+
+func (c *ChatGPT) config() GlobalConfig {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.globalConf
+}
+
+// UpdateConfig replaces the config, clients are recreated with the new settings on next use.
+// MCP servers are not reconnected.
+func (c *ChatGPT) UpdateConfig(conf GlobalConfig) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.globalConf = conf
+	c.clients = map[string]*openai.Client{}
 }
 
-func (c *ChatGPT) Ask(conf ConversationConfig, question string, out io.Writer) error {
+// OnRetry sets the function called before a failed request of Send or Recv is retried.
+func (c *ChatGPT) OnRetry(fn func(RetryEvent)) {
+	c.onRetry = fn
+}
+
+func (c *ChatGPT) Tools() *tools.Registry {
+	return c.tools
+}
+
+func (c *ChatGPT) newRequest(conf ConversationConfig, messages []openai.ChatCompletionMessage) (
+	openai.ChatCompletionRequest,
+	error,
+) {
 	req := openai.ChatCompletionRequest{
-		Model: conf.Model,
-		Messages: []openai.ChatCompletionMessage{
-			{Role: openai.ChatMessageRoleSystem, Content: c.globalConf.LookupPrompt(conf.Prompt)},
-			{Role: openai.ChatMessageRoleUser, Content: question},
-		},
+		Model:       conf.Model,
+		Messages:    messages,
 		MaxTokens:   conf.MaxTokens,
 		Temperature: conf.Temperature,
 		N:           1,
+		Stream:      conf.Stream,
 	}
-	if conf.Stream {
-		stream, err := c.client.CreateChatCompletionStream(context.Background(), req)
-		if err != nil {
-			return err
-		}
-		defer stream.Close()
-		for {
-			resp, err := stream.Recv()
-			if err != nil {
-				if errors.Is(err, io.EOF) {
-					_, _ = fmt.Fprintln(out)
-					break
-				}
-				return err
-			}
-			content := resp.Choices[0].Delta.Content
-			_, _ = fmt.Fprint(out, content)
-		}
-	} else {
-		resp, err := c.client.CreateChatCompletion(context.Background(), req)
-		if err != nil {
-			return err
-		}
-		content := resp.Choices[0].Message.Content
-		_, _ = fmt.Fprintln(out, content)
+	if conf.EnableTools && c.tools.Len() > 0 && toolRounds(messages) < maxToolRounds {
+		req.Tools = c.tools.Definitions()
+	}
+	return req, c.prepareRequest(&req)
+}
+
+// prepareRequest shapes the request for the model, and makes sure it fits in the model's context window.
+func (c *ChatGPT) prepareRequest(req *openai.ChatCompletionRequest) error {
+	conf := c.config()
+	info := conf.ModelInfo(req.Model)
+	info.shapeRequest(req)
+	if info.ContextWindow == 0 {
+		return nil
+	}
+	prompt := tokenizer.CountRequestTokens(*req)
+	if prompt >= info.ContextWindow {
+		return fmt.Errorf(
+			"the request has about %d tokens, more than the %d tokens context window of %s, "+
+				"please forget the context or start a new conversation",
+			prompt, info.ContextWindow, req.Model,
+		)
+	}
+	// The rest of the context window is left for the answer.
+	limit := &req.MaxTokens
+	if req.MaxCompletionTokens > 0 {
+		limit = &req.MaxCompletionTokens
+	}
+	if *limit > info.ContextWindow-prompt {
+		*limit = info.ContextWindow - prompt
 	}
 	return nil
 }
 
+// toolRounds counts the tool calling messages since the last user message.
+func toolRounds(messages []openai.ChatCompletionMessage) int {
+	n := 0
+	for i := len(messages) - 1; i >= 0 && messages[i].Role != openai.ChatMessageRoleUser; i-- {
+		if len(messages[i].ToolCalls) > 0 {
+			n++
+		}
+	}
+	return n
+}
+
 func (c *ChatGPT) Send(conf ConversationConfig, messages []openai.ChatCompletionMessage) (
 	msg string,
 	hasMore bool,
 	err error,
 ) {
-	err = retry.Do(
-		func() error {
-			req := openai.ChatCompletionRequest{
-				Model:       conf.Model,
-				Messages:    messages,
-				MaxTokens:   conf.MaxTokens,
-				Temperature: conf.Temperature,
-				N:           1,
-			}
-			if conf.Stream {
-				stream, err := c.client.CreateChatCompletionStream(context.Background(), req)
-				c.stream = stream
-				if err != nil {
-					return err
-				}
-				resp, err := stream.Recv()
-				if err != nil {
-					return err
-				}
-				if len(resp.Choices) > 0 {
-					msg = resp.Choices[0].Delta.Content
-				}
-				hasMore = true
-			} else {
-				resp, err := c.client.CreateChatCompletion(context.Background(), req)
-				if err != nil {
-					return err
-				}
-				if len(resp.Choices) > 0 {
-					msg = resp.Choices[0].Message.Content
-				}
-				hasMore = false
-			}
-			return nil
+	// The previous answer must be done, its reader is gone then.
+	c.Done()
+	client, err := c.client(conf.Profile)
+	if err != nil {
+		return "", false, err
+	}
+	req, err := c.newRequest(conf, messages)
+	if err != nil {
+		return "", false, err
+	}
+	ctx := context.Background()
+	if req.Stream {
+		ctx, cancel := context.WithCancel(ctx)
+		stream, err := c.openStream(ctx, client, req, c.onRetry)
+		if err != nil {
+			cancel()
+			return "", false, err
+		}
+		resp, err := stream.Recv()
+		if err != nil {
+			cancel()
+			stream.Close()
+			return "", false, err
+		}
+		var calls []openai.ToolCall
+		if len(resp.Choices) > 0 {
+			msg = resp.Choices[0].Delta.Content
+			calls = mergeToolCalls(nil, resp.Choices[0].Delta.ToolCalls)
+		}
+		buffer := newStreamBuffer(calls)
+		go buffer.read(stream)
+		c.streamMu.Lock()
+		c.buffer, c.cancel = buffer, cancel
+		c.streamMu.Unlock()
+		return msg, true, nil
+	}
+
+	var resp openai.ChatCompletionResponse
+	err = c.withRetry(
+		ctx, c.onRetry, func(ctx context.Context) error {
+			resp, err = client.CreateChatCompletion(ctx, req)
+			return err
 		},
-		retry.Attempts(3),
-		retry.LastErrorOnly(true),
 	)
 	if err != nil {
 		return "", false, err
 	}
-	return
+	if len(resp.Choices) > 0 {
+		msg = resp.Choices[0].Message.Content
+		c.streamMu.Lock()
+		c.toolCalls = mergeToolCalls(nil, resp.Choices[0].Message.ToolCalls)
+		c.streamMu.Unlock()
+	}
+	return msg, false, nil
 }
 
+// Recv returns the content streamed since the last call, waiting for some if there is none yet.
+// The stream is read in the background, the tool calls are complete when Recv returns an error. io.EOF is returned
+// when there is no stream, e.g. when a late call arrives after Done.
 func (c *ChatGPT) Recv() (string, error) {
-	resp, err := c.stream.Recv()
-	if err != nil {
-		return "", err
+	c.streamMu.Lock()
+	buffer := c.buffer
+	c.streamMu.Unlock()
+	if buffer == nil {
+		return "", io.EOF
 	}
-	if len(resp.Choices) == 0 {
-		return "", nil
+	return buffer.next()
+}
+
+// mergeToolCalls merges tool calls of a response into calls, streamed tool calls arrive in pieces identified by
+// their index.
+func mergeToolCalls(calls []openai.ToolCall, delta []openai.ToolCall) []openai.ToolCall {
+	for _, call := range delta {
+		idx := len(calls)
+		if call.Index != nil {
+			idx = *call.Index
+		}
+		for len(calls) <= idx {
+			calls = append(calls, openai.ToolCall{Type: openai.ToolTypeFunction})
+		}
+		tc := &calls[idx]
+		if call.ID != "" {
+			tc.ID = call.ID
+		}
+		tc.Function.Name += call.Function.Name
+		tc.Function.Arguments += call.Function.Arguments
+	}
+	return calls
+}
+
+// ToolCalls returns the tool calls requested by the model in the last response, call it before Done.
+func (c *ChatGPT) ToolCalls() []openai.ToolCall {
+	c.streamMu.Lock()
+	received := c.toolCalls
+	if c.buffer != nil {
+		received = c.buffer.calls()
+	}
+	c.streamMu.Unlock()
+	return finishToolCalls(received)
+}
+
+// finishToolCalls returns the merged tool calls without their stream indexes.
+func finishToolCalls(received []openai.ToolCall) []openai.ToolCall {
+	calls := make([]openai.ToolCall, 0, len(received))
+	for _, call := range received {
+		call.Index = nil
+		calls = append(calls, call)
 	}
-	content := resp.Choices[0].Delta.Content
-	return content, nil
+	return calls
 }
 
+func (c *ChatGPT) RunTool(call openai.ToolCall) string {
+	return c.tools.Run(context.Background(), call)
+}
+
+// Done stops receiving the answer, and waits for the background reader to exit.
 func (c *ChatGPT) Done() {
-	if c.stream != nil {
-		c.stream.Close()
+	c.streamMu.Lock()
+	cancel, buffer := c.cancel, c.buffer
+	c.buffer, c.cancel, c.toolCalls = nil, nil, nil
+	c.streamMu.Unlock()
+	if cancel != nil {
+		cancel()
+	}
+	// The reader closes the stream.
+	if buffer != nil {
+		<-buffer.done
+	}
+}
+
+// ListModels lists ids of the models available to the API key of the current profile.
+func (c *ChatGPT) ListModels() ([]string, error) {
+	client, err := c.client(c.config().Conversation.Profile)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.ListModels(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	models := make([]string, 0, len(resp.Models))
+	for _, m := range resp.Models {
+		models = append(models, m.ID)
 	}
-	c.stream = nil
+	sort.Strings(models)
+	return models, nil
 }
@@ -0,0 +1,45 @@
+package chatgpt
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/atotto/clipboard"
+	"github.com/aymanbagabas/go-osc52/v2"
+	"github.com/mattn/go-isatty"
+)
+
+// Clipboard backends, returned by CopyToClipboard.
+const (
+	ClipboardSystem = "system clipboard"
+	ClipboardOSC52  = "OSC 52"
+)
+
+// CopyToClipboard copies the text with the clipboard utility of the system, like pbcopy, xclip or wl-copy. When
+// there is none or it fails, e.g. over SSH or in a container, the text is sent to the terminal in an OSC 52 escape
+// sequence, which is passed through tmux and screen to the outer terminal. Terminals don't acknowledge the
+// sequence, so copying may silently fail with terminals that don't support it.
+func CopyToClipboard(text string, term *os.File) (backend string, err error) {
+	err = clipboard.WriteAll(text)
+	if err == nil {
+		return ClipboardSystem, nil
+	}
+	if term == nil || !isatty.IsTerminal(term.Fd()) && !isatty.IsCygwinTerminal(term.Fd()) {
+		return "", fmt.Errorf("failed to copy to clipboard: %w", err)
+	}
+
+	seq := osc52.New(text)
+	switch {
+	case os.Getenv("TMUX") != "":
+		seq = seq.Tmux()
+	case strings.HasPrefix(os.Getenv("TERM"), "screen"):
+		seq = seq.Screen()
+	}
+	// A single write, which isn't interleaved with concurrent writes to the same file.
+	if _, osc52Err := seq.WriteTo(term); osc52Err != nil {
+		return "", fmt.Errorf("failed to copy to clipboard: %w", errors.Join(err, osc52Err))
+	}
+	return ClipboardOSC52, nil
+}
@@ -0,0 +1,485 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"regexp"
+	"slices"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/charmbracelet/glamour"
+	"github.com/mattn/go-isatty"
+	"golang.org/x/term"
+
+	"github.com/j178/chatgpt"
+)
+
+type command struct {
+	name   string
+	usage  string
+	help   string
+	hidden bool
+	// accepts reports whether the args look like the args of the command, otherwise they are a question that
+	// happens to start with the command name, like `chatgpt show me a poem`.
+	accepts func(args []string) bool
+	run     func(args []string) error
+}
+
+var conversationIDRe = regexp.MustCompile(`^[0-9a-f]+$`)
+
+func noArgs(args []string) bool {
+	return len(args) == 0
+}
+
+// conversationIDs accepts conversation ids, along with flags and their values.
+func conversationIDs(args []string) bool {
+	var ids int
+	for i := 0; i < len(args); i++ {
+		switch {
+		case strings.HasPrefix(args[i], "-"):
+			if !strings.Contains(args[i], "=") {
+				i++ // the value of the flag
+			}
+		case conversationIDRe.MatchString(args[i]):
+			ids++
+		default:
+			return false
+		}
+	}
+	return ids > 0
+}
+
+// oneOf accepts a first arg among the given ones.
+func oneOf(first ...string) func(args []string) bool {
+	return func(args []string) bool {
+		return len(args) > 0 && slices.Contains(first, args[0])
+	}
+}
+
+// batchArgs accepts flags followed by an existing input file, or - for stdin.
+func batchArgs(args []string) bool {
+	if len(args) == 0 {
+		return false
+	}
+	in := args[len(args)-1]
+	if in == "-" {
+		return true
+	}
+	info, err := os.Stat(in)
+	return err == nil && !info.IsDir()
+}
+
+var commands []command
+
+func init() {
+	commands = []command{
+		{name: "ls", usage: "ls", help: "List conversations", accepts: noArgs, run: listConversations},
+		{name: "show", usage: "show <id>", help: "Show a conversation", accepts: conversationIDs, run: showConversation},
+		{name: "rm", usage: "rm <id>...", help: "Remove conversations", accepts: conversationIDs, run: removeConversations},
+		{
+			name:    "export",
+			usage:   "export [-format md|json] <id>",
+			help:    "Export a conversation as markdown or JSON",
+			accepts: conversationIDs,
+			run:     exportConversation,
+		},
+		{
+			name:    "batch",
+			usage:   "batch [-concurrency n] [-o out.jsonl] <in.jsonl>",
+			help:    "Answer prompts from a JSONL file, results are written as JSONL",
+			accepts: batchArgs,
+			run:     batchCommand,
+		},
+		{name: "models", usage: "models", help: "List available models", accepts: noArgs, run: listModels},
+		{
+			name:    "config",
+			usage:   "config get [key] | set <key> <value> | set-key [user] | validate",
+			help:    "Get or set config values, keys are dotted paths like conversation.model. set-key stores the API key in the OS keyring",
+			accepts: oneOf("get", "set", "set-key", "validate"),
+			run:     configCommand,
+		},
+		{
+			name:    "completion",
+			usage:   "completion bash|zsh|fish",
+			help:    "Generate shell completion script",
+			accepts: oneOf("bash", "zsh", "fish"),
+			run:     completionCommand,
+		},
+		{name: "__complete", hidden: true, accepts: func([]string) bool { return true }, run: completeCommand},
+	}
+}
+
+// findCommand returns the command of the args, or nil when they are a question. Questions that look like a
+// command can be asked after --, e.g. `chatgpt -- ls`.
+func findCommand(args []string) *command {
+	if len(args) == 0 || afterDashes() {
+		return nil
+	}
+	for i := range commands {
+		if commands[i].name == args[0] && commands[i].accepts(args[1:]) {
+			return &commands[i]
+		}
+	}
+	return nil
+}
+
+// afterDashes reports whether the args follow a -- terminating the flags.
+func afterDashes() bool {
+	i := len(os.Args) - flag.NArg() - 1
+	return i > 0 && os.Args[i] == "--"
+}
+
+func usage() {
+	out := flag.CommandLine.Output()
+	_, _ = fmt.Fprintf(
+		out,
+		"Usage:\n  chatgpt [flags] [question]\n  chatgpt [flags] -- <question that looks like a command>\n  chatgpt <command> [args]\n\nCommands:\n",
+	)
+	w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	for _, c := range commands {
+		if !c.hidden {
+			_, _ = fmt.Fprintf(w, "  %s\t%s\n", c.usage, c.help)
+		}
+	}
+	_ = w.Flush()
+	_, _ = fmt.Fprintf(out, "\nFlags:\n")
+	flag.PrintDefaults()
+}
+
+func loadConversations() (*chatgpt.ConversationManager, error) {
+	conf, err := chatgpt.LoadConfig()
+	if err != nil {
+		return nil, err
+	}
+	return chatgpt.NewConversationManager(conf, chatgpt.ConversationHistoryFile())
+}
+
+func findConversation(conversations *chatgpt.ConversationManager, id string) (*chatgpt.Conversation, error) {
+	conv := conversations.FindByID(id)
+	if conv == nil {
+		return nil, fmt.Errorf("conversation not found: %s", id)
+	}
+	return conv, nil
+}
+
+func listConversations(args []string) error {
+	conversations, err := loadConversations()
+	if err != nil {
+		return err
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	_, _ = fmt.Fprintln(w, "ID\tUPDATED\tMESSAGES\tPROFILE\tPROMPT\tTITLE")
+	for i, c := range conversations.Conversations {
+		id := c.ID
+		if i == conversations.Idx {
+			id += "*"
+		}
+		updated := "-"
+		if !c.UpdatedAt.IsZero() {
+			updated = c.UpdatedAt.Local().Format("2006-01-02 15:04")
+		}
+		prompt := c.Config.Prompt
+		if r := []rune(prompt); len(r) > 20 {
+			prompt = string(r[:20]) + "..."
+		}
+		profile := c.Config.Profile
+		if profile == "" {
+			profile = "-"
+		}
+		_, _ = fmt.Fprintf(w, "%s\t%s\t%d\t%s\t%s\t%s\n", id, updated, c.Len(), profile, prompt, c.Title())
+	}
+	return w.Flush()
+}
+
+func showConversation(args []string) error {
+	if len(args) != 1 {
+		return errors.New("usage: chatgpt show <id>")
+	}
+	conversations, err := loadConversations()
+	if err != nil {
+		return err
+	}
+	conv, err := findConversation(conversations, args[0])
+	if err != nil {
+		return err
+	}
+	content := conv.Markdown()
+	if isatty.IsTerminal(os.Stdout.Fd()) {
+		renderer, err := glamour.NewTermRenderer(glamour.WithEnvironmentConfig(), glamour.WithWordWrap(100))
+		if err == nil {
+			if rendered, err := renderer.Render(content); err == nil {
+				content = rendered
+			}
+		}
+	}
+	_, err = fmt.Fprint(os.Stdout, content)
+	return err
+}
+
+func removeConversations(args []string) error {
+	if len(args) == 0 {
+		return errors.New("usage: chatgpt rm <id>...")
+	}
+	unlock := lock()
+	defer unlock()
+
+	conversations, err := loadConversations()
+	if err != nil {
+		return err
+	}
+	var toRemove []*chatgpt.Conversation
+	for _, id := range args {
+		conv, err := findConversation(conversations, id)
+		if err != nil {
+			return err
+		}
+		toRemove = append(toRemove, conv)
+	}
+	for _, conv := range toRemove {
+		conversations.Remove(conv)
+		_, _ = fmt.Fprintf(os.Stderr, "Removed conversation %s\n", conv.ID)
+	}
+	return conversations.Dump()
+}
+
+func exportConversation(args []string) error {
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	format := fs.String("format", "md", "Export format, md or json")
+	_ = fs.Parse(args)
+	if fs.NArg() != 1 {
+		return errors.New("usage: chatgpt export [-format md|json] <id>")
+	}
+
+	conversations, err := loadConversations()
+	if err != nil {
+		return err
+	}
+	conv, err := findConversation(conversations, fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	switch *format {
+	case "md", "markdown":
+		_, err = fmt.Fprint(os.Stdout, conv.Markdown())
+		return err
+	case "json":
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(conv)
+	default:
+		return fmt.Errorf("unknown format: %s", *format)
+	}
+}
+
+func listModels(args []string) error {
+	conf, err := chatgpt.InitConfig(*profile)
+	if err != nil {
+		return err
+	}
+	bot, err := chatgpt.NewChatGPT(conf)
+	if err != nil {
+		return err
+	}
+	models, err := bot.ListModels()
+	if err != nil {
+		return err
+	}
+	for _, m := range models {
+		_, _ = fmt.Fprintln(os.Stdout, m)
+	}
+	return nil
+}
+
+func configCommand(args []string) error {
+	if len(args) == 0 {
+		return errors.New("usage: chatgpt config get [key] | set <key> <value> | set-key [user] | validate")
+	}
+	switch args[0] {
+	case "get":
+		conf, err := chatgpt.LoadConfig()
+		if err != nil {
+			return err
+		}
+		key := ""
+		if len(args) > 1 {
+			key = args[1]
+		}
+		v, err := chatgpt.GetConfigValue(conf, key)
+		if err != nil {
+			return err
+		}
+		// Secrets are printed only when asked for by their key.
+		v = chatgpt.MaskSecrets(key, v)
+		if s, ok := v.(string); ok {
+			_, err = fmt.Fprintln(os.Stdout, s)
+			return err
+		}
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(v)
+	case "set":
+		if len(args) != 3 {
+			return errors.New("usage: chatgpt config set <key> <value>")
+		}
+		return chatgpt.SetConfigValue(args[1], args[2])
+	case "set-key":
+		user := "default"
+		if len(args) > 1 {
+			user = args[1]
+		}
+		key, err := readAPIKey()
+		if err != nil {
+			return err
+		}
+		if err := chatgpt.StoreAPIKey(user, key); err != nil {
+			return err
+		}
+		if err := chatgpt.SetConfigValue("api_key_keyring", user); err != nil {
+			return err
+		}
+		_, _ = fmt.Fprintf(os.Stderr, "API key stored in the keyring as %q\n", user)
+		// A plaintext key takes precedence over the keyring.
+		removed, err := chatgpt.RemoveConfigValue("api_key")
+		switch {
+		case err != nil:
+			_, _ = fmt.Fprintf(os.Stderr, "Warning: api_key in the config file takes precedence over the keyring: %v\n", err)
+		case removed:
+			_, _ = fmt.Fprintln(os.Stderr, "Removed the plaintext api_key from the config file")
+		}
+		if os.Getenv("OPENAI_API_KEY") != "" {
+			_, _ = fmt.Fprintln(os.Stderr, "Warning: OPENAI_API_KEY takes precedence over the keyring, unset it to use the stored key")
+		}
+		return nil
+	case "validate":
+		problems, err := chatgpt.ValidateConfig()
+		if err != nil {
+			return err
+		}
+		errs := 0
+		for _, p := range problems {
+			_, _ = fmt.Fprintln(os.Stdout, p)
+			if !p.Warning {
+				errs++
+			}
+		}
+		if errs > 0 {
+			return fmt.Errorf("%d errors found in %s", errs, chatgpt.ConfigFile())
+		}
+		_, _ = fmt.Fprintf(os.Stderr, "%s is valid\n", chatgpt.ConfigFile())
+		return nil
+	default:
+		return fmt.Errorf("unknown config command: %s", args[0])
+	}
+}
+
+func batchCommand(args []string) error {
+	fs := flag.NewFlagSet("batch", flag.ExitOnError)
+	concurrency := fs.Int("concurrency", 4, "Number of requests in flight")
+	output := fs.String("o", "", "Append results to this file instead of stdout, ids already answered in it are skipped")
+	_ = fs.Parse(args)
+	if fs.NArg() != 1 {
+		return errors.New("usage: chatgpt batch [-concurrency n] [-o out.jsonl] <in.jsonl>")
+	}
+
+	conf, err := chatgpt.InitConfig(*profile)
+	if err != nil {
+		return err
+	}
+	printConfigWarnings(conf)
+
+	var in io.Reader = os.Stdin
+	if fs.Arg(0) != "-" {
+		f, err := os.Open(fs.Arg(0))
+		if err != nil {
+			return fmt.Errorf("failed to open input: %w", err)
+		}
+		defer func() { _ = f.Close() }()
+		in = f
+	}
+
+	opts := chatgpt.BatchOptions{Concurrency: *concurrency}
+	var out io.Writer = os.Stdout
+	resume := "rerun with -o to be able to resume"
+	if *output != "" {
+		f, err := os.OpenFile(*output, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0o644)
+		if err != nil {
+			return fmt.Errorf("failed to open output: %w", err)
+		}
+		defer func() { _ = f.Close() }()
+		opts.Done, err = chatgpt.ReadBatchDone(f)
+		if err != nil {
+			return fmt.Errorf("failed to read output: %w", err)
+		}
+		out = f
+		resume = "rerun with the same -o to resume"
+	} else if done, ok := readStdoutBatchDone(); ok {
+		opts.Done = done
+		resume = "rerun appending to the same file with >> to resume"
+	}
+	if len(opts.Done) > 0 {
+		_, _ = fmt.Fprintf(os.Stderr, "Skipping %d answered lines\n", len(opts.Done))
+	}
+
+	var processed, failed int
+	opts.OnResult = func(result chatgpt.BatchResult) {
+		processed++
+		if result.Error != "" {
+			failed++
+			_, _ = fmt.Fprintf(os.Stderr, "%s: %s\n", result.ID, result.Error)
+		}
+	}
+
+	bot, err := chatgpt.NewChatGPT(conf)
+	if err != nil {
+		return err
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	err = bot.RunBatch(ctx, conf.Conversation, in, out, opts)
+	_, _ = fmt.Fprintf(os.Stderr, "Processed %d lines, %d failed\n", processed, failed)
+	if errors.Is(err, context.Canceled) {
+		return errors.New("interrupted, " + resume)
+	}
+	if err == nil && failed > 0 {
+		err = fmt.Errorf("%d lines failed", failed)
+	}
+	return err
+}
+
+// readStdoutBatchDone reads the answered ids when stdout is redirected to a file, e.g. with >>. The file is reopened
+// for reading through /dev/stdout, which fails on systems where that duplicates the write-only descriptor instead.
+func readStdoutBatchDone() (map[string]bool, bool) {
+	fi, err := os.Stdout.Stat()
+	if err != nil || !fi.Mode().IsRegular() {
+		return nil, false
+	}
+	f, err := os.Open("/dev/stdout")
+	if err != nil {
+		return nil, false
+	}
+	defer func() { _ = f.Close() }()
+	done, err := chatgpt.ReadBatchDone(f)
+	if err != nil {
+		return nil, false
+	}
+	return done, true
+}
+
+// readAPIKey reads the API key from the terminal without echoing it, or from stdin.
+func readAPIKey() (string, error) {
+	if !isatty.IsTerminal(os.Stdin.Fd()) {
+		data, err := io.ReadAll(os.Stdin)
+		return string(data), err
+	}
+	_, _ = fmt.Fprint(os.Stderr, "API key: ")
+	data, err := term.ReadPassword(int(os.Stdin.Fd()))
+	_, _ = fmt.Fprintln(os.Stderr)
+	return string(data), err
+}
@@ -0,0 +1,266 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/j178/chatgpt"
+)
+
+const bashCompletion = `# bash completion for chatgpt
+_chatgpt() {
+    local IFS=$'\n'
+    COMPREPLY=($(chatgpt __complete bash "${COMP_WORDS[@]:1:$COMP_CWORD}" 2>/dev/null))
+}
+complete -o default -F _chatgpt chatgpt
+`
+
+const zshCompletion = `#compdef chatgpt
+# zsh completion for chatgpt
+_chatgpt() {
+    local -a values
+    values=(${(f)"$(chatgpt __complete zsh "${(@)words[2,CURRENT]}" 2>/dev/null)"})
+    if (( ${#values} == 0 )); then
+        _files
+        return
+    fi
+    _describe 'values' values
+}
+compdef _chatgpt chatgpt
+`
+
+const fishCompletion = `# fish completion for chatgpt
+function __chatgpt_complete
+    set -l values (chatgpt __complete fish (commandline -opc)[2..-1] (commandline -ct) 2>/dev/null)
+    if test (count $values) -eq 0
+        __fish_complete_path (commandline -ct)
+        return
+    end
+    printf '%s\n' $values
+end
+complete -c chatgpt -f -a '(__chatgpt_complete)'
+`
+
+// flagsWithValue returns the global flags that take a value, i.e. all but the boolean ones.
+func flagsWithValue() map[string]bool {
+	flags := map[string]bool{}
+	flag.VisitAll(
+		func(f *flag.Flag) {
+			if b, ok := f.Value.(interface{ IsBoolFlag() bool }); ok && b.IsBoolFlag() {
+				return
+			}
+			flags[f.Name] = true
+		},
+	)
+	return flags
+}
+
+type candidate struct {
+	value string
+	desc  string
+}
+
+func completionCommand(args []string) error {
+	if len(args) != 1 {
+		return errors.New("usage: chatgpt completion bash|zsh|fish")
+	}
+	var script string
+	switch args[0] {
+	case "bash":
+		script = bashCompletion
+	case "zsh":
+		script = zshCompletion
+	case "fish":
+		script = fishCompletion
+	default:
+		return fmt.Errorf("unsupported shell: %s", args[0])
+	}
+	_, err := fmt.Fprint(os.Stdout, script)
+	return err
+}
+
+// completeCommand prints the completion candidates for the words, the last word is the one being completed.
+// It's called by the completion scripts.
+func completeCommand(args []string) error {
+	if len(args) < 2 {
+		return nil
+	}
+	shell, words := args[0], args[1:]
+	cur := words[len(words)-1]
+	for _, c := range completions(words) {
+		if !strings.HasPrefix(c.value, cur) {
+			continue
+		}
+		desc := strings.Join(strings.Fields(c.desc), " ")
+		if r := []rune(desc); len(r) > 60 {
+			desc = string(r[:60]) + "..."
+		}
+		switch {
+		case shell == "zsh" && desc != "":
+			_, _ = fmt.Fprintf(os.Stdout, "%s:%s\n", strings.ReplaceAll(c.value, ":", `\:`), desc)
+		case shell == "zsh":
+			_, _ = fmt.Fprintln(os.Stdout, strings.ReplaceAll(c.value, ":", `\:`))
+		case shell == "fish" && desc != "":
+			_, _ = fmt.Fprintf(os.Stdout, "%s\t%s\n", c.value, desc)
+		default:
+			_, _ = fmt.Fprintln(os.Stdout, c.value)
+		}
+	}
+	return nil
+}
+
+func completions(words []string) []candidate {
+	cur := words[len(words)-1]
+	prev := ""
+	if len(words) > 1 {
+		prev = strings.TrimLeft(words[len(words)-2], "-")
+	}
+	// Completing must not create the config file.
+	conf, _ := chatgpt.ReadConfig()
+
+	switch prev {
+	case "p":
+		return promptCandidates(conf)
+	case "i":
+		return nil
+	case "c":
+		return conversationCandidates(conf)
+	case "profile":
+		var candidates []candidate
+		for _, name := range conf.ProfileNames() {
+			candidates = append(candidates, candidate{name, conf.Profiles[name].Endpoint})
+		}
+		return candidates
+	case "output":
+		return []candidate{{outputText, ""}, {outputJSON, ""}, {outputJSONLStream, ""}}
+	}
+
+	// Find the subcommand and its positional arguments.
+	var (
+		cmd       string
+		rest      []string
+		withValue = flagsWithValue()
+	)
+	for i := 0; i < len(words)-1; i++ {
+		w := words[i]
+		if cmd != "" {
+			rest = append(rest, w)
+			continue
+		}
+		if strings.HasPrefix(w, "-") {
+			if withValue[strings.TrimLeft(w, "-")] {
+				i++
+			}
+			continue
+		}
+		cmd = w
+	}
+
+	switch cmd {
+	case "":
+		if strings.HasPrefix(cur, "-") {
+			return flagCandidates()
+		}
+		var candidates []candidate
+		for _, c := range commands {
+			if !c.hidden {
+				candidates = append(candidates, candidate{c.name, c.help})
+			}
+		}
+		return candidates
+	case "show", "rm", "export":
+		if strings.HasPrefix(cur, "-") && cmd == "export" {
+			return []candidate{{"-format", "Export format, md or json"}}
+		}
+		if prev == "format" {
+			return []candidate{{"md", ""}, {"json", ""}}
+		}
+		return conversationCandidates(conf)
+	case "batch":
+		if strings.HasPrefix(cur, "-") {
+			return []candidate{
+				{"-concurrency", "Number of requests in flight"},
+				{"-o", "Append results to this file, ids already answered in it are skipped"},
+			}
+		}
+	case "completion":
+		return []candidate{{"bash", ""}, {"zsh", ""}, {"fish", ""}}
+	case "config":
+		switch len(rest) {
+		case 0:
+			return []candidate{
+				{"get", "Get config values"},
+				{"set", "Set a config value"},
+				{"set-key", "Store the API key in the OS keyring"},
+				{"validate", "Check the config file"},
+			}
+		case 1:
+			if rest[0] != "get" && rest[0] != "set" {
+				return nil
+			}
+			var candidates []candidate
+			for _, k := range chatgpt.ConfigKeys(conf) {
+				candidates = append(candidates, candidate{k, ""})
+			}
+			return candidates
+		case 2:
+			if rest[0] == "set" {
+				return configValueCandidates(conf, rest[1])
+			}
+		}
+	}
+	return nil
+}
+
+func flagCandidates() []candidate {
+	var candidates []candidate
+	flag.VisitAll(
+		func(f *flag.Flag) {
+			candidates = append(candidates, candidate{"-" + f.Name, f.Usage})
+		},
+	)
+	return candidates
+}
+
+func promptCandidates(conf chatgpt.GlobalConfig) []candidate {
+	var candidates []candidate
+	for _, k := range conf.PromptKeys() {
+		candidates = append(candidates, candidate{k, conf.PromptDescription(k)})
+	}
+	return candidates
+}
+
+func modelCandidates(conf chatgpt.GlobalConfig) []candidate {
+	var candidates []candidate
+	for _, m := range chatgpt.KnownModels(conf) {
+		candidates = append(candidates, candidate{m, ""})
+	}
+	return candidates
+}
+
+func conversationCandidates(conf chatgpt.GlobalConfig) []candidate {
+	conversations, err := chatgpt.NewConversationManager(conf, chatgpt.ConversationHistoryFile())
+	if err != nil {
+		return nil
+	}
+	var candidates []candidate
+	for _, c := range conversations.Conversations {
+		candidates = append(candidates, candidate{c.ID, c.Title()})
+	}
+	return candidates
+}
+
+func configValueCandidates(conf chatgpt.GlobalConfig, key string) []candidate {
+	switch {
+	case strings.HasSuffix(key, ".model") || key == "model":
+		return modelCandidates(conf)
+	case strings.HasSuffix(key, ".prompt"):
+		return promptCandidates(conf)
+	case strings.HasSuffix(key, ".stream"):
+		return []candidate{{"true", ""}, {"false", ""}}
+	}
+	return nil
+}
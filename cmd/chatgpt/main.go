@@ -1,11 +1,14 @@
 package main
 
 import (
+	"bufio"
+	"errors"
 	"flag"
 	"fmt"
 	"io"
 	"log"
 	"os"
+	"os/exec"
 	"runtime"
 	"strings"
 
@@ -18,6 +21,9 @@ import (
 	"github.com/j178/chatgpt/ui"
 )
 
+// minIDPrefixLength is the shortest id prefix -c takes as a conversation id.
+const minIDPrefixLength = 4
+
 var (
 	version              = "dev"
 	date                 = "unknown"
@@ -27,23 +33,52 @@ var (
 	showVersion          = flag.Bool("v", false, "Show version")
 	startNewConversation = flag.Bool("n", false, "Start new conversation")
 	detachMode           = flag.Bool("d", false, "Run in detach mode, conversation will not be saved")
+	shellMode            = flag.Bool("x", false, "Suggest a shell command for the task, and offer to execute it")
+	output               = flag.String("output", outputText, "Output format of one-time mode: text, json or jsonl-stream")
+	continueConversation = flag.Bool("c", false, "Continue the current conversation, or the one whose id is given as the first argument")
+	profile              = flag.String("profile", "", "Profile to use, defaults to $CHATGPT_PROFILE or `profile` in config file")
+	imagePaths           stringsFlag
+	promptVars           stringsFlag
 )
 
+func init() {
+	flag.Var(&imagePaths, "i", "Attach an image file to the question, can be repeated (one-time mode)")
+	flag.Var(&promptVars, "var", "Set a prompt template variable as `key=value`, can be repeated")
+}
+
+type stringsFlag []string
+
+func (s *stringsFlag) String() string {
+	return strings.Join(*s, ",")
+}
+
+func (s *stringsFlag) Set(v string) error {
+	*s = append(*s, v)
+	return nil
+}
+
 // TODO support switch model in TUI
 // TODO support switch prompt in TUI
 
 func main() {
 	log.SetFlags(0)
+	flag.Usage = usage
 	flag.Parse()
 	if *showVersion {
 		fmt.Print(buildVersion())
 		return
 	}
+	if cmd := findCommand(flag.Args()); cmd != nil {
+		if err := cmd.run(flag.Args()[1:]); err != nil {
+			exit(err)
+		}
+		return
+	}
 
 	ui.Debug = debug
 	ui.DetachMode = *detachMode
 
-	conf, err := chatgpt.InitConfig()
+	conf, err := chatgpt.InitConfig(*profile)
 	if err != nil {
 		exit(err)
 	}
@@ -52,25 +87,40 @@ func main() {
 	if *promptKey != "" {
 		conf.Conversation.Prompt = *promptKey
 	}
+	conf.PromptVars, err = readPromptVars(conf)
+	if err != nil {
+		exit(err)
+	}
 
-	bot := chatgpt.NewChatGPT(conf)
-	// One-time ask-and-response mode
+	bot, err := chatgpt.NewChatGPT(conf)
+	if err != nil {
+		exit(err)
+	}
+	closeBot = bot.Close
+	defer bot.Close()
 	args := flag.Args()
 	pipeIn := !isatty.IsTerminal(os.Stdin.Fd()) && !isatty.IsCygwinTerminal(os.Stdin.Fd())
-	if pipeIn || len(args) > 0 {
-		var question string
-		if pipeIn {
-			data, err := io.ReadAll(os.Stdin)
-			if err != nil {
-				exit(err)
-			}
-			question = string(data)
-		} else {
-			question = strings.Join(args, " ")
+	// The chat UI shows them in the footer.
+	if pipeIn || len(args) > 0 || *shellMode {
+		printConfigWarnings(conf)
+	}
+	if *shellMode {
+		if !pipeIn && len(args) == 0 {
+			exit(errors.New("please describe the task for the shell command, e.g. `chatgpt -x \"list files by size\"`"))
+		}
+		err := runShellMode(bot, conf.Conversation, readQuestion(pipeIn, args))
+		if err != nil {
+			exit(err)
 		}
+		return
+	}
 
-		conversationConf := conf.Conversation
-		err := bot.Ask(conversationConf, question, os.Stdout)
+	// One-time ask-and-response mode, the conversation is saved only when continuing a saved one.
+	if (pipeIn || len(args) > 0) && !*continueConversation {
+		conversations, _ := chatgpt.NewConversationManager(conf, "")
+		conv := conversations.New(conf.Conversation)
+		connectMCPServers(bot, conv.Config.EnableTools)
+		err := ask(bot, conv, readQuestion(pipeIn, args))
 		if err != nil {
 			exit(err)
 		}
@@ -78,19 +128,8 @@ func main() {
 	}
 
 	if !*detachMode {
-		lockFile, _ := single.New("chatgpt")
-		if err := lockFile.Lock(); err != nil {
-			exit(
-				fmt.Errorf(
-					"Another chatgpt instance is running, chatgpt works not well with multiple instances, "+
-						"please close the other one first. \n"+
-						"If you are sure there is no other chatgpt instance running, please delete the lock file: %s\n"+
-						"You can also try `chatgpt -d` to run in detach mode, this check will be skipped, but conversation will not be saved.",
-					lockFile.Lockfile(),
-				),
-			)
-		}
-		defer func() { _ = lockFile.Unlock() }()
+		unlock := lock()
+		defer unlock()
 	}
 
 	conversations, err := chatgpt.NewConversationManager(conf, chatgpt.ConversationHistoryFile())
@@ -98,7 +137,34 @@ func main() {
 		exit(err)
 	}
 
-	if *startNewConversation {
+	if *continueConversation {
+		var conv *chatgpt.Conversation
+		// A short first word is part of the question, not an id prefix.
+		if len(args) > 0 && len(args[0]) >= minIDPrefixLength {
+			conv = conversations.FindByID(args[0])
+			if conv != nil {
+				args = args[1:]
+			}
+		}
+		if conv == nil {
+			conv = conversations.Curr()
+		}
+		conversations.SetCurr(conv)
+
+		if pipeIn || len(args) > 0 {
+			connectMCPServers(bot, conv.Config.EnableTools)
+			err := ask(bot, conv, readQuestion(pipeIn, args))
+			if err != nil {
+				exit(err)
+			}
+			if !*detachMode {
+				if err := conversations.Dump(); err != nil {
+					exit(err)
+				}
+			}
+			return
+		}
+	} else if *startNewConversation {
 		conversations.New(conf.Conversation)
 	} else if *promptKey != "" {
 		// If prompt is specified, try to find conversation with the same prompt.
@@ -111,6 +177,12 @@ func main() {
 		}
 	}
 
+	enableTools := conf.Conversation.EnableTools
+	for _, conv := range conversations.Conversations {
+		enableTools = enableTools || conv.Config.EnableTools
+	}
+	connectMCPServers(bot, enableTools)
+
 	p := tea.NewProgram(
 		ui.InitialModel(conf, bot, conversations),
 		// enable mouse motion will make text not able to select
@@ -124,12 +196,127 @@ func main() {
 		log.SetOutput(io.Discard)
 	}
 
+	if updates, stop, err := chatgpt.WatchConfig(*profile); err == nil {
+		defer stop()
+		go func() {
+			for update := range updates {
+				if *promptKey != "" {
+					update.Config.Conversation.Prompt = *promptKey
+				}
+				update.Config.PromptVars = conf.PromptVars
+				p.Send(ui.ConfigMsg(update))
+			}
+		}()
+	}
+
 	if _, err := p.Run(); err != nil {
 		exit(err)
 	}
 }
 
+// connectMCPServers starts the MCP servers when tools are enabled, they are of no use otherwise.
+func connectMCPServers(bot *chatgpt.ChatGPT, enableTools bool) {
+	if !enableTools {
+		return
+	}
+	if err := bot.ConnectMCPServers(version); err != nil {
+		exit(err)
+	}
+}
+
+func readQuestion(pipeIn bool, args []string) string {
+	if pipeIn {
+		data, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			exit(err)
+		}
+		return string(data)
+	}
+	return strings.Join(args, " ")
+}
+
+// readPromptVars parses the -var flags, and asks for the other variables used by the prompt when run in a terminal.
+func readPromptVars(conf chatgpt.GlobalConfig) (map[string]string, error) {
+	vars := map[string]string{}
+	for _, v := range promptVars {
+		key, value, ok := strings.Cut(v, "=")
+		if !ok || key == "" {
+			return nil, fmt.Errorf("invalid -var %q, expected key=value", v)
+		}
+		vars[key] = value
+	}
+	conf.PromptVars = vars
+	missing := conf.MissingPromptVars(conf.Conversation.Prompt)
+	if len(missing) == 0 {
+		return vars, nil
+	}
+	if !isatty.IsTerminal(os.Stdin.Fd()) && !isatty.IsCygwinTerminal(os.Stdin.Fd()) {
+		return nil, fmt.Errorf(
+			"prompt variables are not set: %s, set them with -var key=value",
+			strings.Join(missing, ", "),
+		)
+	}
+	reader := bufio.NewReader(os.Stdin)
+	for _, name := range missing {
+		_, _ = fmt.Fprintf(os.Stderr, "%s: ", name)
+		line, err := reader.ReadString('\n')
+		if err != nil && line == "" {
+			return nil, fmt.Errorf("failed to read prompt variable %s: %w", name, err)
+		}
+		vars[name] = strings.TrimRight(line, "\r\n")
+	}
+	return vars, nil
+}
+
+func readImages() []chatgpt.Image {
+	var images []chatgpt.Image
+	for _, path := range imagePaths {
+		img, err := chatgpt.SaveImage(path)
+		if err != nil {
+			exit(err)
+		}
+		images = append(images, img)
+	}
+	return images
+}
+
+// lock makes sure only one instance is writing the conversation history.
+func lock() func() {
+	lockFile, _ := single.New("chatgpt")
+	if err := lockFile.Lock(); err != nil {
+		exit(
+			fmt.Errorf(
+				"Another chatgpt instance is running, chatgpt works not well with multiple instances, "+
+					"please close the other one first. \n"+
+					"If you are sure there is no other chatgpt instance running, please delete the lock file: %s\n"+
+					"You can also try `chatgpt -d` to run in detach mode, this check will be skipped, but conversation will not be saved.",
+				lockFile.Lockfile(),
+			),
+		)
+	}
+	return func() { _ = lockFile.Unlock() }
+}
+
+// closeBot disconnects the MCP servers on exit, os.Exit skips the deferred calls.
+var closeBot = func() {}
+
+// printConfigWarnings reports the problems of the config file that don't prevent using it.
+func printConfigWarnings(conf chatgpt.GlobalConfig) {
+	for _, p := range conf.Warnings {
+		_, _ = fmt.Fprintln(os.Stderr, p)
+	}
+}
+
 func exit(err error) {
+	closeBot()
+	if errors.Is(err, errOutputWritten) {
+		os.Exit(1)
+	}
+	// Exit with the status of the failed command in shell mode.
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		os.Exit(exitErr.ExitCode())
+	}
 	_, _ = fmt.Fprintf(
 		os.Stderr,
 		"%s: %s\n",
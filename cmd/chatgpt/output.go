@@ -0,0 +1,106 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/sashabaranov/go-openai"
+
+	"github.com/j178/chatgpt"
+)
+
+const (
+	outputText        = "text"
+	outputJSON        = "json"
+	outputJSONLStream = "jsonl-stream"
+)
+
+type errorOutput struct {
+	Message    string `json:"message"`
+	Type       string `json:"type,omitempty"`
+	Code       any    `json:"code,omitempty"`
+	StatusCode int    `json:"status_code,omitempty"`
+}
+
+func newErrorOutput(err error) errorOutput {
+	out := errorOutput{Message: err.Error()}
+	var apiErr *openai.APIError
+	var reqErr *openai.RequestError
+	switch {
+	case errors.As(err, &apiErr):
+		out.Message = apiErr.Message
+		out.Type = apiErr.Type
+		out.Code = apiErr.Code
+		out.StatusCode = apiErr.HTTPStatusCode
+	case errors.As(err, &reqErr):
+		out.StatusCode = reqErr.HTTPStatusCode
+	}
+	return out
+}
+
+// errOutputWritten means the error has been reported in the output, only the exit status is left.
+var errOutputWritten = errors.New("error written to output")
+
+// ask asks the question in the conversation, and writes the answer to stdout in the requested format.
+func ask(bot *chatgpt.ChatGPT, conv *chatgpt.Conversation, question string) error {
+	enc := json.NewEncoder(os.Stdout)
+	opts := chatgpt.AskOptions{Images: readImages()}
+
+	switch *output {
+	case outputText:
+		wrote := false
+		opts.OnEvent = func(e chatgpt.Event) {
+			switch e.Type {
+			case chatgpt.EventDelta:
+				wrote = true
+				_, _ = fmt.Fprint(os.Stdout, e.Content)
+			case chatgpt.EventToolCall:
+				if wrote {
+					_, _ = fmt.Fprintln(os.Stdout)
+					wrote = false
+				}
+				_, _ = fmt.Fprintf(os.Stderr, "[tool] %s(%s)\n", e.ToolCall.Name, e.ToolCall.Arguments)
+			case chatgpt.EventRetry:
+				_, _ = fmt.Fprintf(
+					os.Stderr, "[retry] %s, retrying in %.1fs (attempt %d/%d)\n",
+					e.Content, float64(e.DelayMs)/1000, e.Attempt, e.MaxAttempts,
+				)
+			case chatgpt.EventWarning:
+				_, _ = fmt.Fprintf(os.Stderr, "[warning] %s\n", e.Content)
+			}
+		}
+		_, err := bot.Ask(conv, question, opts)
+		if wrote {
+			_, _ = fmt.Fprintln(os.Stdout)
+		}
+		return err
+	case outputJSON:
+		opts.IncludeUsage = true
+		result, err := bot.Ask(conv, question, opts)
+		if err != nil {
+			_ = enc.Encode(map[string]any{"error": newErrorOutput(err)})
+			return errOutputWritten
+		}
+		return enc.Encode(result)
+	case outputJSONLStream:
+		opts.IncludeUsage = true
+		opts.OnEvent = func(e chatgpt.Event) {
+			_ = enc.Encode(e)
+		}
+		result, err := bot.Ask(conv, question, opts)
+		if err != nil {
+			_ = enc.Encode(map[string]any{"type": "error", "error": newErrorOutput(err)})
+			return errOutputWritten
+		}
+		return enc.Encode(
+			struct {
+				Type string `json:"type"`
+				*chatgpt.Result
+			}{"done", result},
+		)
+	default:
+		return fmt.Errorf("unknown output format: %s", *output)
+	}
+}
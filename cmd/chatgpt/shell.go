@@ -0,0 +1,97 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+
+	"github.com/sashabaranov/go-openai"
+
+	"github.com/j178/chatgpt"
+	"github.com/j178/chatgpt/ui"
+)
+
+// maxFeedbackStderr limits how much of the failed command's stderr is sent back to the model.
+const maxFeedbackStderr = 4096
+
+// tailBuffer keeps the last bytes written to it.
+type tailBuffer struct {
+	bytes.Buffer
+}
+
+func (b *tailBuffer) Write(p []byte) (int, error) {
+	n, _ := b.Buffer.Write(p)
+	if extra := b.Len() - maxFeedbackStderr; extra > 0 {
+		b.Next(extra)
+	}
+	return n, nil
+}
+
+// runShellMode asks for a shell command performing the task, and offers to execute it.
+func runShellMode(bot *chatgpt.ChatGPT, conf chatgpt.ConversationConfig, task string) error {
+	conf.Stream = false
+	conf.EnableTools = false
+	messages := chatgpt.ShellCommandMessages(task)
+	for {
+		answer, _, err := bot.Send(conf, messages)
+		if err != nil {
+			return err
+		}
+		messages = append(messages, openai.ChatCompletionMessage{Role: openai.ChatMessageRoleAssistant, Content: answer})
+
+		command, explanation := chatgpt.ParseShellCommand(answer)
+		if command == "" {
+			return errors.New("no command was suggested")
+		}
+		action, command, err := ui.ConfirmCommand(command, explanation)
+		if err != nil {
+			return err
+		}
+		switch action {
+		case ui.CommandCancel:
+			return nil
+		case ui.CommandCopy:
+			backend, err := chatgpt.CopyToClipboard(command, os.Stderr)
+			if err != nil {
+				return err
+			}
+			if backend == chatgpt.ClipboardOSC52 {
+				_, _ = fmt.Fprintln(os.Stderr, "Copied via OSC 52")
+			} else {
+				_, _ = fmt.Fprintln(os.Stderr, "Copied to the clipboard")
+			}
+			return nil
+		}
+
+		stderr := &tailBuffer{}
+		sh, flag := chatgpt.Shell()
+		cmd := exec.Command(sh, flag, command)
+		cmd.Stdin = os.Stdin
+		cmd.Stdout = os.Stdout
+		cmd.Stderr = io.MultiWriter(os.Stderr, stderr)
+		err = cmd.Run()
+		var exitErr *exec.ExitError
+		if !errors.As(err, &exitErr) {
+			return err
+		}
+
+		fix, err := ui.Confirm(fmt.Sprintf("Command failed with exit status %d, ask ChatGPT to fix it?", exitErr.ExitCode()))
+		if err != nil || !fix {
+			return exitErr
+		}
+		messages = append(
+			messages, openai.ChatCompletionMessage{
+				Role: openai.ChatMessageRoleUser,
+				Content: fmt.Sprintf(
+					"I ran `%s`, it failed with exit status %d and this stderr output:\n%s\nPlease fix the command.",
+					command,
+					exitErr.ExitCode(),
+					stderr.String(),
+				),
+			},
+		)
+	}
+}
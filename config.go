@@ -1,15 +1,19 @@
 package chatgpt
 
 import (
+	"bytes"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
+	"time"
 
 	"github.com/mitchellh/go-homedir"
 	"github.com/sashabaranov/go-openai"
+	"github.com/tailscale/hujson"
 )
 
 type ConversationConfig struct {
@@ -19,6 +23,9 @@ type ConversationConfig struct {
 	Stream        bool    `json:"stream"`
 	Temperature   float32 `json:"temperature"`
 	MaxTokens     int     `json:"max_tokens"`
+	EnableTools   bool    `json:"enable_tools,omitempty"`
+	// Profile is the profile that created the conversation, its API settings are used to answer.
+	Profile string `json:"profile,omitempty"`
 }
 
 type KeyMapConfig struct {
@@ -37,28 +44,251 @@ type KeyMapConfig struct {
 	NextConversation       []string `json:"next_conversation,omitempty"`
 	RemoveConversation     []string `json:"remove_conversation,omitempty"`
 	ForgetContext          []string `json:"forget_context,omitempty"`
+	AttachImage            []string `json:"attach_image,omitempty"`
+	SelectMessage          []string `json:"select_message,omitempty"`
+}
+
+// Themes are the built-in color themes of the TUI.
+var Themes = []string{"dark", "light", "high-contrast"}
+
+// ThemeConfig configures the look of the TUI.
+type ThemeConfig struct {
+	// Name is one of Themes, dark or light is chosen by the terminal background by default.
+	Name string `json:"name,omitempty"`
+	// GlamourStyle is the markdown style, a glamour style name like "dracula" or the path of a JSON style file.
+	// It defaults to $GLAMOUR_STYLE, or the light or dark style matching the theme.
+	GlamourStyle string      `json:"glamour_style,omitempty"`
+	UserLabel    string      `json:"user_label,omitempty"` // defaults to "You"
+	BotLabel     string      `json:"bot_label,omitempty"`  // defaults to "ChatGPT"
+	Colors       ThemeColors `json:"colors"`
+}
+
+// ThemeColors override the colors of the theme, as ANSI color numbers like "5" or hex colors like "#ff00ff".
+type ThemeColors struct {
+	User    string `json:"user,omitempty"`
+	Bot     string `json:"bot,omitempty"`
+	Error   string `json:"error,omitempty"`
+	Confirm string `json:"confirm,omitempty"`
+	Border  string `json:"border,omitempty"`
+}
+
+// MCPServerConfig configures a Model Context Protocol server, which is either launched
+// as a subprocess (Command) or reached over HTTP (URL).
+type MCPServerConfig struct {
+	Command string            `json:"command,omitempty"`
+	Args    []string          `json:"args,omitempty"`
+	Env     map[string]string `json:"env,omitempty"`
+	URL     string            `json:"url,omitempty"`
+	Headers map[string]string `json:"headers,omitempty"`
+	// Trusted servers' tools are run without confirmation.
+	Trusted bool `json:"trusted,omitempty"`
 }
 
 type GlobalConfig struct {
-	APIKey       string             `json:"api_key"`
-	Endpoint     string             `json:"endpoint"`
-	APIType      openai.APIType     `json:"api_type,omitempty"`
-	APIVersion   string             `json:"api_version,omitempty"`   // required when APIType is APITypeAzure or APITypeAzureAD
-	ModelMapping map[string]string  `json:"model_mapping,omitempty"` // required when APIType is APITypeAzure or APITypeAzureAD
-	OrgID        string             `json:"org_id,omitempty"`
-	Prompts      map[string]string  `json:"prompts"`
-	Conversation ConversationConfig `json:"conversation"` // Default conversation config
-	KeyMap       KeyMapConfig       `json:"key_map"`
+	APIKey string `json:"api_key"`
+	// Alternatives to the plaintext api_key, the first one set is used.
+	APIKeyCommand string                     `json:"api_key_command,omitempty"` // command printing the key, e.g. `pass show openai`
+	APIKeyFile    string                     `json:"api_key_file,omitempty"`
+	APIKeyKeyring string                     `json:"api_key_keyring,omitempty"` // user name of the key in the OS keyring
+	Endpoint      string                     `json:"endpoint"`
+	APIType       openai.APIType             `json:"api_type,omitempty"`
+	APIVersion    string                     `json:"api_version,omitempty"`   // required when APIType is APITypeAzure or APITypeAzureAD
+	ModelMapping  map[string]string          `json:"model_mapping,omitempty"` // required when APIType is APITypeAzure or APITypeAzureAD
+	OrgID         string                     `json:"org_id,omitempty"`
+	Prompts       map[string]string          `json:"prompts"`
+	Conversation  ConversationConfig         `json:"conversation"` // Default conversation config
+	KeyMap        KeyMapConfig               `json:"key_map"`
+	Theme         ThemeConfig                `json:"theme"`
+	MCPServers    map[string]MCPServerConfig `json:"mcp_servers,omitempty"`
+	HTTP          HTTPConfig                 `json:"http"`
+	Retry         RetryConfig                `json:"retry"`
+	Profiles      map[string]ProfileConfig   `json:"profiles,omitempty"`
+	Models        map[string]ModelInfo       `json:"models,omitempty"`     // by model name or glob pattern, overrides the built-in ones
+	Profile       string                     `json:"profile,omitempty"`    // profile used by default
+	FrameRate     int                        `json:"frame_rate,omitempty"` // renders per second of streamed answers, defaults to 30
+
+	// PromptLibrary holds the prompts in PromptsDir, they take precedence over Prompts.
+	PromptLibrary map[string]Prompt `json:"-"`
+	// PromptVars are the values of the prompt template variables, e.g. `{{.lang}}`.
+	PromptVars map[string]string `json:"-"`
+	// Warnings are the unknown keys and unset environment variables found in the config file.
+	Warnings []ConfigProblem `json:"-"`
+
+	base *GlobalConfig // the config before a profile is applied
 }
 
+// ProfileConfig overrides the API settings and conversation defaults of the top-level config, unset fields are inherited.
+type ProfileConfig struct {
+	APIKey        string            `json:"api_key,omitempty"`
+	APIKeyCommand string            `json:"api_key_command,omitempty"`
+	APIKeyFile    string            `json:"api_key_file,omitempty"`
+	APIKeyKeyring string            `json:"api_key_keyring,omitempty"`
+	Endpoint      string            `json:"endpoint,omitempty"`
+	APIType       openai.APIType    `json:"api_type,omitempty"`
+	APIVersion    string            `json:"api_version,omitempty"`
+	ModelMapping  map[string]string `json:"model_mapping,omitempty"`
+	OrgID         string            `json:"org_id,omitempty"`
+	HTTP          *HTTPConfig       `json:"http,omitempty"`
+	// Conversation holds the conversation config fields to override.
+	Conversation json.RawMessage `json:"conversation,omitempty"`
+}
+
+// Duration is written as a string like "1.5s" in the config file, plain numbers are seconds.
+type Duration time.Duration
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var v any
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	switch v := v.(type) {
+	case float64:
+		*d = Duration(v * float64(time.Second))
+	case string:
+		parsed, err := time.ParseDuration(v)
+		if err != nil {
+			return err
+		}
+		*d = Duration(parsed)
+	default:
+		return fmt.Errorf("invalid duration: %s", data)
+	}
+	return nil
+}
+
+// ProfileNames returns names of the configured profiles.
+func (c *GlobalConfig) ProfileNames() []string {
+	names := make([]string, 0, len(c.Profiles))
+	for name := range c.Profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// WithProfile returns the config with the named profile applied, an empty name means no profile.
+func (c GlobalConfig) WithProfile(name string) (GlobalConfig, error) {
+	base := c
+	if c.base != nil {
+		base = *c.base
+	}
+	conf := base
+	conf.base = &base
+	conf.Conversation.Profile = ""
+	if name == "" {
+		return conf, nil
+	}
+	p, ok := base.Profiles[name]
+	if !ok {
+		return GlobalConfig{}, fmt.Errorf("unknown profile: %s, available profiles: %s", name, strings.Join(base.ProfileNames(), ", "))
+	}
+	// A key source of the profile replaces all the inherited ones.
+	if p.APIKey != "" || p.APIKeyCommand != "" || p.APIKeyFile != "" || p.APIKeyKeyring != "" {
+		conf.APIKey = p.APIKey
+		conf.APIKeyCommand = p.APIKeyCommand
+		conf.APIKeyFile = p.APIKeyFile
+		conf.APIKeyKeyring = p.APIKeyKeyring
+	}
+	if p.Endpoint != "" {
+		conf.Endpoint = p.Endpoint
+	}
+	if p.APIType != "" {
+		conf.APIType = p.APIType
+	}
+	if p.APIVersion != "" {
+		conf.APIVersion = p.APIVersion
+	}
+	if p.ModelMapping != nil {
+		conf.ModelMapping = p.ModelMapping
+	}
+	if p.OrgID != "" {
+		conf.OrgID = p.OrgID
+	}
+	if p.HTTP != nil {
+		conf.HTTP = *p.HTTP
+	}
+	if len(p.Conversation) > 0 {
+		if err := json.Unmarshal(p.Conversation, &conf.Conversation); err != nil {
+			return GlobalConfig{}, fmt.Errorf("invalid conversation config of profile %s: %w", name, err)
+		}
+	}
+	conf.Conversation.Profile = name
+	return conf, nil
+}
+
+// LookupPrompt returns the rendered prompt of the key, the key itself is used as the prompt when it's not predefined.
 func (c *GlobalConfig) LookupPrompt(key string) string {
-	prompt := c.Prompts[key]
-	if prompt == "" {
-		return key
+	text := c.promptText(key)
+	prompt, err := renderPrompt(text, c.PromptVars)
+	if err != nil {
+		return text
 	}
 	return prompt
 }
 
+func (c *GlobalConfig) promptText(key string) string {
+	if p, ok := c.PromptLibrary[key]; ok {
+		return p.Text
+	}
+	if prompt := c.Prompts[key]; prompt != "" {
+		return prompt
+	}
+	return key
+}
+
+// PromptKeys returns keys of the predefined prompts.
+func (c *GlobalConfig) PromptKeys() []string {
+	keys := make([]string, 0, len(c.Prompts)+len(c.PromptLibrary))
+	for k := range c.Prompts {
+		keys = append(keys, k)
+	}
+	for k := range c.PromptLibrary {
+		if _, ok := c.Prompts[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// PromptDescription returns the description of the predefined prompt, or the prompt itself.
+func (c *GlobalConfig) PromptDescription(key string) string {
+	if p, ok := c.PromptLibrary[key]; ok && p.Description != "" {
+		return p.Description
+	}
+	return c.promptText(key)
+}
+
+// ConfigKeys returns dotted paths of all the leaf values in the config.
+func ConfigKeys(conf GlobalConfig) []string {
+	data, err := json.Marshal(conf)
+	if err != nil {
+		return nil
+	}
+	var root map[string]any
+	if err := json.Unmarshal(data, &root); err != nil {
+		return nil
+	}
+	var keys []string
+	var walk func(prefix string, m map[string]any)
+	walk = func(prefix string, m map[string]any) {
+		for k, v := range m {
+			if child, ok := v.(map[string]any); ok && len(child) > 0 {
+				walk(prefix+k+".", child)
+				continue
+			}
+			keys = append(keys, prefix+k)
+		}
+	}
+	walk("", root)
+	sort.Strings(keys)
+	return keys
+}
+
 func ConversationHistoryFile() string {
 	dir := configDir()
 	return filepath.Join(dir, "conversations.json")
@@ -72,37 +302,41 @@ func configDir() string {
 	return filepath.Join(home, ".config", "chatgpt")
 }
 
-func readOrCreateConfig(conf *GlobalConfig) error {
-	dir := configDir()
-	path := filepath.Join(dir, "config.json")
+// readConfig reads the config file into conf, a missing file is created with conf when create is set.
+func readConfig(conf *GlobalConfig, create bool) error {
+	path := ConfigFile()
 
-	f, err := os.Open(path)
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) && !create {
+		return nil
+	}
 	if errors.Is(err, os.ErrNotExist) {
 		err = os.MkdirAll(filepath.Dir(path), 0o700)
 		if err != nil {
 			return fmt.Errorf("failed to create config dir: %w", err)
 		}
-		f, err = os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0600)
+		data, err = json.MarshalIndent(conf, "", "  ")
 		if err != nil {
-			return fmt.Errorf("failed to create config file: %w", err)
+			return err
 		}
-		defer func() { _ = f.Close() }()
-		enc := json.NewEncoder(f)
-		enc.SetIndent("", "  ")
-		err = enc.Encode(conf)
+		err = os.WriteFile(path, append(data, '\n'), 0o600)
 		if err != nil {
 			return fmt.Errorf("failed to write config file: %w", err)
 		}
 		return nil
 	}
 	if err != nil {
-		return fmt.Errorf("failed to open config file: %w", err)
+		return fmt.Errorf("failed to read config file: %w", err)
+	}
+	src, err := parseConfigFile(path, data)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %w", err)
 	}
-	defer func() { _ = f.Close() }()
-	err = json.NewDecoder(f).Decode(conf)
+	err = src.decode(conf)
 	if err != nil {
 		return fmt.Errorf("failed to read config file: %w", err)
 	}
+	conf.Warnings = src.warnings()
 	return nil
 }
 
@@ -123,10 +357,23 @@ func defaultKeyMapConfig() KeyMapConfig {
 		NextConversation:       []string{"ctrl+right", "ctrl+o"},
 		RemoveConversation:     []string{"ctrl+r"},
 		ForgetContext:          []string{"ctrl+x"},
+		AttachImage:            []string{"alt+i"},
+		SelectMessage:          []string{"ctrl+s"},
 	}
 }
 
-func InitConfig() (GlobalConfig, error) {
+// LoadConfig reads the config file and environment variables, the API key is not required. A default config file
+// is created when there is none.
+func LoadConfig() (GlobalConfig, error) {
+	return loadConfig(true)
+}
+
+// ReadConfig is like LoadConfig, but it never writes the config file, e.g. for shell completion.
+func ReadConfig() (GlobalConfig, error) {
+	return loadConfig(false)
+}
+
+func loadConfig(create bool) (GlobalConfig, error) {
 	conf := GlobalConfig{
 		APIType:  openai.APITypeOpenAI,
 		Endpoint: "https://api.openai.com/v1",
@@ -144,8 +391,17 @@ func InitConfig() (GlobalConfig, error) {
 			MaxTokens:     4096,
 		},
 		KeyMap: defaultKeyMapConfig(),
+		Retry: RetryConfig{
+			MaxAttempts:  4,
+			InitialDelay: Duration(time.Second),
+			MaxDelay:     Duration(30 * time.Second),
+		},
 	}
-	err := readOrCreateConfig(&conf)
+	err := readConfig(&conf, create)
+	if err != nil {
+		return GlobalConfig{}, err
+	}
+	conf.PromptLibrary, err = loadPrompts(PromptsDir())
 	if err != nil {
 		return GlobalConfig{}, err
 	}
@@ -157,18 +413,277 @@ func InitConfig() (GlobalConfig, error) {
 	if endpoint != "" {
 		conf.Endpoint = endpoint
 	}
+	return conf, nil
+}
+
+// InitConfig loads the config with the profile applied, the profile defaults to $CHATGPT_PROFILE or the
+// `profile` in the config file.
+func InitConfig(profile string) (GlobalConfig, error) {
+	conf, err := LoadConfig()
+	if err != nil {
+		return GlobalConfig{}, err
+	}
+	if profile == "" {
+		profile = os.Getenv("CHATGPT_PROFILE")
+	}
+	if profile == "" {
+		profile = conf.Profile
+	}
+	conf, err = conf.WithProfile(profile)
+	if err != nil {
+		return GlobalConfig{}, err
+	}
+	return conf.resolve()
+}
 
-	if conf.APIKey == "" {
+// resolve reads the API key and checks the API settings.
+func (c GlobalConfig) resolve() (GlobalConfig, error) {
+	if c.APIKey == "" {
+		var err error
+		c.APIKey, err = resolveAPIKey(c)
+		if err != nil {
+			return GlobalConfig{}, err
+		}
+	}
+	if c.APIKey == "" {
 		confDir := configDir()
-		return GlobalConfig{}, fmt.Errorf("Missing API key. Set it in `%s/config.json` or by setting the `OPENAI_API_KEY` environment variable. You can find or create your API key at https://platform.openai.com/account/api-keys.", confDir)
+		return GlobalConfig{}, fmt.Errorf("Missing API key. Set it in `%s/config.json` (`api_key`, `api_key_command`, `api_key_file` or `api_key_keyring`) or by setting the `OPENAI_API_KEY` environment variable. You can find or create your API key at https://platform.openai.com/account/api-keys.", confDir)
 	}
 
-	conf.APIType = openai.APIType(strings.ToUpper(string(conf.APIType)))
-	switch conf.APIType {
+	c.APIType = openai.APIType(strings.ToUpper(string(c.APIType)))
+	switch c.APIType {
 	case openai.APITypeOpenAI, openai.APITypeAzure, openai.APITypeAzureAD:
 	default:
-		return GlobalConfig{}, fmt.Errorf("unknown API type: %s", conf.APIType)
+		return GlobalConfig{}, fmt.Errorf("unknown API type: %s", c.APIType)
 	}
 
-	return conf, nil
+	return c, nil
+}
+
+func splitConfigKey(key string) ([]string, error) {
+	parts := strings.Split(key, ".")
+	for _, p := range parts {
+		if p == "" {
+			return nil, fmt.Errorf("invalid key: %q", key)
+		}
+	}
+	return parts, nil
+}
+
+// GetConfigValue returns the value of a dotted key (e.g. `conversation.model`) in the config, or the whole config
+// when the key is empty.
+func GetConfigValue(conf GlobalConfig, key string) (any, error) {
+	var parts []string
+	if key != "" {
+		var err error
+		parts, err = splitConfigKey(key)
+		if err != nil {
+			return nil, err
+		}
+	}
+	data, err := json.Marshal(conf)
+	if err != nil {
+		return nil, err
+	}
+	var v any
+	err = json.Unmarshal(data, &v)
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range parts {
+		m, ok := v.(map[string]any)
+		if !ok {
+			return nil, fmt.Errorf("key not found: %s", key)
+		}
+		v, ok = m[p]
+		if !ok {
+			return nil, fmt.Errorf("key not found: %s", key)
+		}
+	}
+	return v, nil
+}
+
+// MaskSecrets hides the API keys, headers and environment variables in the value of the key got by GetConfigValue,
+// so that printing the config doesn't leak them. A secret is kept when its own key is asked for.
+func MaskSecrets(key string, v any) any {
+	return maskSecrets(key[strings.LastIndex(key, ".")+1:], v)
+}
+
+func maskSecrets(key string, v any) any {
+	m, ok := v.(map[string]any)
+	if !ok {
+		return v
+	}
+	masked := make(map[string]any, len(m))
+	for k, v := range m {
+		if s, ok := v.(string); ok && (k == "api_key" || key == "headers" || key == "env") {
+			v = maskSecret(s)
+		}
+		masked[k] = maskSecrets(k, v)
+	}
+	return masked
+}
+
+func maskSecret(s string) string {
+	if len(s) <= 8 {
+		return strings.Repeat("*", len(s))
+	}
+	return s[:3] + "..." + s[len(s)-4:]
+}
+
+// SetConfigValue sets a dotted key in the config file. The value is parsed as JSON if possible,
+// otherwise it's used as a string. Comments in the file are kept.
+func SetConfigValue(key, value string) error {
+	parts, err := splitConfigKey(key)
+	if err != nil {
+		return err
+	}
+
+	path := ConfigFile()
+	if !isJSONConfig(path) {
+		return fmt.Errorf("config set only supports JSON config files, please edit %s instead", path)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to read config file: %w", err)
+	}
+	if len(bytes.TrimSpace(data)) == 0 {
+		data = []byte("{}")
+	}
+	root, err := hujson.Parse(data)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	// Try the value as JSON first, then as a plain string.
+	candidates := []any{value}
+	var v any
+	if err := json.Unmarshal([]byte(value), &v); err == nil {
+		candidates = []any{v, value}
+	}
+	var patched hujson.Value
+	for _, v := range candidates {
+		patched, err = patchConfig(root.Clone(), parts, v)
+		if err != nil {
+			continue
+		}
+		// Make sure the new config is still valid.
+		standard := patched.Clone()
+		standard.Standardize()
+		var conf GlobalConfig
+		err = json.Unmarshal(standard.Pack(), &conf)
+		if err == nil {
+			break
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("invalid value for %s: %w", key, err)
+	}
+
+	return writeConfigFile(path, patched, root.IsStandard())
+}
+
+// RemoveConfigValue removes a dotted key from the config file, and reports whether it was there.
+func RemoveConfigValue(key string) (bool, error) {
+	parts, err := splitConfigKey(key)
+	if err != nil {
+		return false, err
+	}
+
+	path := ConfigFile()
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to read config file: %w", err)
+	}
+	src, err := parseConfigFile(path, data)
+	if err != nil {
+		return false, fmt.Errorf("failed to read config file: %w", err)
+	}
+	if _, ok := src.lines[strings.Join(parts, ".")]; !ok {
+		return false, nil
+	}
+	if !isJSONConfig(path) {
+		return false, fmt.Errorf("please remove %s from %s", key, path)
+	}
+	root, err := hujson.Parse(data)
+	if err != nil {
+		return false, fmt.Errorf("failed to read config file: %w", err)
+	}
+	patched := root.Clone()
+	op, err := json.Marshal([]map[string]any{{"op": "remove", "path": configPointer(parts)}})
+	if err != nil {
+		return false, err
+	}
+	if err := patched.Patch(op); err != nil {
+		return false, fmt.Errorf("failed to remove %s: %w", key, err)
+	}
+	return true, writeConfigFile(path, patched, root.IsStandard())
+}
+
+// writeConfigFile writes the patched config, standard is whether the original file was plain JSON.
+func writeConfigFile(path string, patched hujson.Value, standard bool) error {
+	err := os.MkdirAll(filepath.Dir(path), 0o700)
+	if err != nil {
+		return fmt.Errorf("failed to create config dir: %w", err)
+	}
+	var data []byte
+	if standard {
+		// Keep plain JSON files plain.
+		patched.Standardize()
+		var buf bytes.Buffer
+		if err := json.Indent(&buf, patched.Pack(), "", "  "); err != nil {
+			return err
+		}
+		data = buf.Bytes()
+	} else {
+		patched.Format()
+		data = patched.Pack()
+	}
+	data = append(bytes.TrimRight(data, "\n"), '\n')
+	return os.WriteFile(path, data, 0o600)
+}
+
+// configPointer returns the JSON pointer of the key path.
+func configPointer(parts []string) string {
+	ptr := ""
+	for _, p := range parts {
+		ptr += "/" + strings.NewReplacer("~", "~0", "/", "~1").Replace(p)
+	}
+	return ptr
+}
+
+// patchConfig sets the value at the key path, missing parent objects are created.
+func patchConfig(root hujson.Value, parts []string, value any) (hujson.Value, error) {
+	ptr := ""
+	for i, p := range parts {
+		ptr += "/" + strings.NewReplacer("~", "~0", "/", "~1").Replace(p)
+		if i < len(parts)-1 {
+			if found := root.Find(ptr); found != nil {
+				if _, ok := found.Value.(*hujson.Object); ok {
+					continue
+				}
+			}
+			value = nestValue(parts[i+1:], value)
+		}
+		op, err := json.Marshal([]map[string]any{{"op": "add", "path": ptr, "value": value}})
+		if err != nil {
+			return hujson.Value{}, err
+		}
+		if err := root.Patch(op); err != nil {
+			return hujson.Value{}, err
+		}
+		return root, nil
+	}
+	return root, nil
+}
+
+// nestValue wraps the value into objects, {"a": {"b": value}} for keys a and b.
+func nestValue(keys []string, value any) any {
+	for i := len(keys) - 1; i >= 0; i-- {
+		value = map[string]any{keys[i]: value}
+	}
+	return value
 }
@@ -0,0 +1,347 @@
+package chatgpt
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"github.com/tailscale/hujson"
+	"gopkg.in/yaml.v3"
+)
+
+// configFileNames are the supported config files, the first existing one is used.
+// JSON files may contain comments and trailing commas.
+var configFileNames = []string{"config.json", "config.jsonc", "config.yaml", "config.yml", "config.toml"}
+
+// ConfigFile returns the path of the config file in use, config.json if none exists yet.
+func ConfigFile() string {
+	dir := configDir()
+	for _, name := range configFileNames {
+		path := filepath.Join(dir, name)
+		if _, err := os.Stat(path); err == nil {
+			return path
+		}
+	}
+	return filepath.Join(dir, configFileNames[0])
+}
+
+func isJSONConfig(path string) bool {
+	ext := filepath.Ext(path)
+	return ext == ".json" || ext == ".jsonc"
+}
+
+// configSource is a parsed config file.
+type configSource struct {
+	path  string
+	data  map[string]any
+	lines map[string]int // dotted key => line number
+	// missingEnv holds the ${VAR} references to unset environment variables, by dotted key.
+	missingEnv map[string][]string
+	// literalEnv holds the ${VAR} references in keys that are not expanded, by dotted key.
+	literalEnv map[string][]string
+}
+
+func (s *configSource) line(key string) int {
+	for ; key != ""; key = key[:max(strings.LastIndex(key, "."), 0)] {
+		if line, ok := s.lines[key]; ok {
+			return line
+		}
+	}
+	return 0
+}
+
+func parseConfigFile(path string, b []byte) (*configSource, error) {
+	s := &configSource{path: path, lines: map[string]int{}, missingEnv: map[string][]string{}, literalEnv: map[string][]string{}}
+	var err error
+	switch ext := filepath.Ext(path); ext {
+	case ".json", ".jsonc":
+		err = s.parseJSON(b)
+	case ".yaml", ".yml":
+		err = s.parseYAML(b)
+	case ".toml":
+		err = s.parseTOML(b)
+	default:
+		err = fmt.Errorf("unsupported config format: %s", ext)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if s.data == nil {
+		s.data = map[string]any{}
+	}
+	s.data = s.expandEnv(nil, s.data).(map[string]any)
+	return s, nil
+}
+
+func (s *configSource) parseJSON(b []byte) error {
+	v, err := hujson.Parse(b)
+	if err != nil {
+		return err
+	}
+	var walk func(prefix string, v hujson.Value)
+	walk = func(prefix string, v hujson.Value) {
+		obj, ok := v.Value.(*hujson.Object)
+		if !ok {
+			return
+		}
+		for _, m := range obj.Members {
+			name, ok := m.Name.Value.(hujson.Literal)
+			if !ok {
+				continue
+			}
+			key := prefix + name.String()
+			s.lines[key] = 1 + bytes.Count(b[:m.Name.StartOffset], []byte("\n"))
+			walk(key+".", m.Value)
+		}
+	}
+	walk("", v)
+	v.Standardize()
+	return json.Unmarshal(v.Pack(), &s.data)
+}
+
+func (s *configSource) parseYAML(b []byte) error {
+	var root yaml.Node
+	if err := yaml.Unmarshal(b, &root); err != nil {
+		return err
+	}
+	var walk func(prefix string, n *yaml.Node)
+	walk = func(prefix string, n *yaml.Node) {
+		if n.Kind == yaml.DocumentNode && len(n.Content) > 0 {
+			walk(prefix, n.Content[0])
+			return
+		}
+		if n.Kind != yaml.MappingNode {
+			return
+		}
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			key := prefix + n.Content[i].Value
+			s.lines[key] = n.Content[i].Line
+			walk(key+".", n.Content[i+1])
+		}
+	}
+	walk("", &root)
+	return root.Decode(&s.data)
+}
+
+var tomlKeyRe = regexp.MustCompile(`^\s*([A-Za-z0-9_\-."' ]+?)\s*=`)
+
+func (s *configSource) parseTOML(b []byte) error {
+	if _, err := toml.Decode(string(b), &s.data); err != nil {
+		return err
+	}
+	// The decoder doesn't keep positions, find the lines of the tables and keys.
+	table := ""
+	scanner := bufio.NewScanner(bytes.NewReader(b))
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		switch {
+		case strings.HasPrefix(text, "["):
+			table = strings.Trim(text, "[] ")
+			table = tomlKey(table)
+			s.lines[table] = line
+			table += "."
+		case tomlKeyRe.MatchString(text):
+			key := table + tomlKey(tomlKeyRe.FindStringSubmatch(text)[1])
+			s.lines[key] = line
+		}
+	}
+	return nil
+}
+
+// tomlKey removes quotes and spaces around the parts of a dotted key.
+func tomlKey(key string) string {
+	parts := strings.Split(key, ".")
+	for i, p := range parts {
+		parts[i] = strings.Trim(strings.TrimSpace(p), `"'`)
+	}
+	return strings.Join(parts, ".")
+}
+
+var envRe = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)(?::-([^}]*))?\}`)
+
+// envKeys are the keys whose values may refer to environment variables: credentials, URLs and headers, also in
+// profiles. Other values, like prompts and commands, are used as written. "*" matches any key.
+var envKeys = [][]string{
+	{"api_key"},
+	{"api_key_file"},
+	{"endpoint"},
+	{"http", "proxy"},
+	{"http", "headers", "*"},
+	{"mcp_servers", "*", "url"},
+	{"mcp_servers", "*", "headers", "*"},
+	{"mcp_servers", "*", "env", "*"},
+}
+
+func expandsEnv(path []string) bool {
+	if len(path) > 2 && path[0] == "profiles" {
+		path = path[2:]
+	}
+	for _, pattern := range envKeys {
+		if len(pattern) == len(path) && slices.EqualFunc(
+			pattern, path, func(p, k string) bool { return p == "*" || p == k },
+		) {
+			return true
+		}
+	}
+	return false
+}
+
+// expandEnv replaces ${VAR} and ${VAR:-default} with environment variables in the values of envKeys.
+func (s *configSource) expandEnv(path []string, v any) any {
+	switch v := v.(type) {
+	case string:
+		key := strings.Join(path, ".")
+		if !expandsEnv(path) {
+			for _, m := range envRe.FindAllStringSubmatch(v, -1) {
+				s.literalEnv[key] = append(s.literalEnv[key], m[0])
+			}
+			return v
+		}
+		return envRe.ReplaceAllStringFunc(
+			v, func(ref string) string {
+				m := envRe.FindStringSubmatch(ref)
+				if value, ok := os.LookupEnv(m[1]); ok {
+					return value
+				}
+				if strings.Contains(ref, ":-") {
+					return m[2]
+				}
+				s.missingEnv[key] = append(s.missingEnv[key], m[1])
+				return ""
+			},
+		)
+	case map[string]any:
+		for k, child := range v {
+			v[k] = s.expandEnv(append(slices.Clip(path), k), child)
+		}
+	case []any:
+		for i, child := range v {
+			v[i] = s.expandEnv(path, child)
+		}
+	}
+	return v
+}
+
+// warnings returns the unknown keys, the unset environment variables and the references to environment variables
+// that are used as written, which are ignored when loading the config.
+func (s *configSource) warnings() []ConfigProblem {
+	var problems []ConfigProblem
+	report := func(key string, format string, args ...any) {
+		problems = append(
+			problems, ConfigProblem{
+				File:    s.path,
+				Line:    s.line(key),
+				Key:     key,
+				Message: fmt.Sprintf(format, args...),
+				Warning: true,
+			},
+		)
+	}
+	for _, key := range s.unknownKeys() {
+		report(key, "unknown key")
+	}
+	for key, vars := range s.missingEnv {
+		for _, v := range vars {
+			report(key, "environment variable %s is not set", v)
+		}
+	}
+	for key, refs := range s.literalEnv {
+		for _, ref := range refs {
+			report(
+				key, "%s is used as written, environment variables are only expanded in credentials, URLs and headers",
+				ref,
+			)
+		}
+	}
+	return sortProblems(problems)
+}
+
+func joinKey(prefix, key string) string {
+	if prefix == "" {
+		return key
+	}
+	return prefix + "." + key
+}
+
+// decode decodes the config file on top of conf.
+func (s *configSource) decode(conf *GlobalConfig) error {
+	data, err := json.Marshal(s.data)
+	if err != nil {
+		return err
+	}
+	err = json.Unmarshal(data, conf)
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &typeErr) && typeErr.Field != "" {
+		return fmt.Errorf("%s:%d: invalid value for %s: %s", s.path, s.line(typeErr.Field), typeErr.Field, typeErr.Value)
+	}
+	return err
+}
+
+// unknownKeys returns the dotted keys in the config file that don't exist in GlobalConfig.
+func (s *configSource) unknownKeys() []string {
+	var keys []string
+	var walk func(prefix string, v any, t reflect.Type)
+	walk = func(prefix string, v any, t reflect.Type) {
+		for t.Kind() == reflect.Pointer {
+			t = t.Elem()
+		}
+		m, ok := v.(map[string]any)
+		if !ok {
+			return
+		}
+		switch t.Kind() {
+		case reflect.Map:
+			for k, child := range m {
+				walk(joinKey(prefix, k), child, t.Elem())
+			}
+		case reflect.Struct:
+			fields := jsonFields(t)
+			for k, child := range m {
+				f, ok := fields[k]
+				if !ok {
+					keys = append(keys, joinKey(prefix, k))
+					continue
+				}
+				// Partial conversation configs of profiles.
+				if f.Type == reflect.TypeOf(json.RawMessage{}) && k == "conversation" {
+					walk(joinKey(prefix, k), child, reflect.TypeOf(ConversationConfig{}))
+					continue
+				}
+				walk(joinKey(prefix, k), child, f.Type)
+			}
+		}
+	}
+	walk("", s.data, reflect.TypeOf(GlobalConfig{}))
+	sort.Strings(keys)
+	return keys
+}
+
+// jsonFields returns the exported fields of a struct by their JSON names.
+func jsonFields(t reflect.Type) map[string]reflect.StructField {
+	fields := map[string]reflect.StructField{}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		fields[name] = f
+	}
+	return fields
+}
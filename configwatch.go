@@ -0,0 +1,117 @@
+package chatgpt
+
+import (
+	"fmt"
+	"path/filepath"
+	"slices"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// configReloadDelay collects the burst of events editors make when saving a file.
+const configReloadDelay = 200 * time.Millisecond
+
+// ConfigUpdate is sent when the config file changes.
+type ConfigUpdate struct {
+	Config GlobalConfig
+	// Err is set when the new config can't be used, the previous config should be kept.
+	Err error
+	// Problems are found by ValidateConfig in the new config.
+	Problems []ConfigProblem
+	// NewErrors are the errors in Problems that the config in use doesn't have. The new config should not be used
+	// when there are any, errors it already had don't prevent it.
+	NewErrors []ConfigProblem
+}
+
+// newErrors returns the errors in problems that are not in known, compared without their lines, which move as the
+// file is edited.
+func newErrors(problems, known []ConfigProblem) []ConfigProblem {
+	var errs []ConfigProblem
+	for _, p := range problems {
+		if p.Warning {
+			continue
+		}
+		if !slices.ContainsFunc(
+			known, func(k ConfigProblem) bool { return !k.Warning && k.Key == p.Key && k.Message == p.Message },
+		) {
+			errs = append(errs, p)
+		}
+	}
+	return errs
+}
+
+// WatchConfig watches the config and prompts directories, and sends the reloaded config with the profile applied on changes.
+// The directory is watched instead of the file, since editors often replace the file when saving.
+func WatchConfig(profile string) (<-chan ConfigUpdate, func(), error) {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to watch config: %w", err)
+	}
+	if err := watcher.Add(configDir()); err != nil {
+		_ = watcher.Close()
+		return nil, nil, fmt.Errorf("failed to watch config: %w", err)
+	}
+	// The prompts directory is optional.
+	_ = watcher.Add(PromptsDir())
+
+	// The errors of the config in use, which is validated only when it's reloaded.
+	known, _ := ValidateConfig()
+
+	updates := make(chan ConfigUpdate, 1)
+	done := make(chan struct{})
+	go func() {
+		defer close(updates)
+		var reload <-chan time.Time
+		for {
+			select {
+			case <-done:
+				return
+			case event, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				if isConfigFile(event.Name) && !event.Has(fsnotify.Chmod) {
+					reload = time.After(configReloadDelay)
+				}
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				select {
+				case updates <- ConfigUpdate{Err: fmt.Errorf("failed to watch config: %w", err)}:
+				case <-done:
+					return
+				}
+			case <-reload:
+				reload = nil
+				var update ConfigUpdate
+				update.Config, update.Err = InitConfig(profile)
+				if update.Err == nil {
+					update.Problems, _ = ValidateConfig()
+					update.NewErrors = newErrors(update.Problems, known)
+					if len(update.NewErrors) == 0 {
+						known = update.Problems
+					}
+				}
+				select {
+				case updates <- update:
+				case <-done:
+					return
+				}
+			}
+		}
+	}()
+	stop := func() {
+		close(done)
+		_ = watcher.Close()
+	}
+	return updates, stop, nil
+}
+
+func isConfigFile(path string) bool {
+	if filepath.Dir(path) == PromptsDir() {
+		return filepath.Ext(path) == ".md"
+	}
+	return slices.Contains(configFileNames, filepath.Base(path))
+}
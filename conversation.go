@@ -1,10 +1,14 @@
 package chatgpt
 
 import (
+	"crypto/rand"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"os"
+	"strings"
+	"time"
 
 	"github.com/sashabaranov/go-openai"
 
@@ -32,6 +36,11 @@ func NewConversationManager(conf GlobalConfig, historyFile string) (*Conversatio
 	return h, nil
 }
 
+// SetConfig replaces the config, which provides the prompts and the defaults of new conversations.
+func (m *ConversationManager) SetConfig(conf GlobalConfig) {
+	m.globalConf = conf
+}
+
 func (m *ConversationManager) Dump() error {
 	if m.file == "" {
 		return nil
@@ -44,6 +53,7 @@ func (m *ConversationManager) Dump() error {
 	if err != nil {
 		return err
 	}
+	defer func() { _ = f.Close() }()
 	enc := json.NewEncoder(f)
 	enc.SetIndent("", "  ")
 	err = enc.Encode(m)
@@ -61,20 +71,35 @@ func (m *ConversationManager) Load() error {
 		}
 		return err
 	}
+	defer func() { _ = f.Close() }()
 	err = json.NewDecoder(f).Decode(m)
 	if err != nil {
 		return err
 	}
 	for _, c := range m.Conversations {
 		c.manager = m
+		if c.ID == "" {
+			c.ID = newConversationID()
+		}
 	}
 	return nil
 }
 
+func newConversationID() string {
+	b := make([]byte, 4)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
 func (m *ConversationManager) New(conf ConversationConfig) *Conversation {
+	conf = m.globalConf.withPromptDefaults(conf)
+	now := time.Now()
 	c := &Conversation{
-		manager: m,
-		Config:  conf,
+		manager:   m,
+		ID:        newConversationID(),
+		CreatedAt: now,
+		UpdatedAt: now,
+		Config:    conf,
 	}
 	m.Conversations = append(m.Conversations, c)
 	m.Idx = len(m.Conversations) - 1
@@ -91,6 +116,41 @@ func (m *ConversationManager) FindByPrompt(prompt string) *Conversation {
 	return nil
 }
 
+// FindByID finds the conversation by its id, or an unambiguous prefix of it.
+func (m *ConversationManager) FindByID(id string) *Conversation {
+	if id == "" {
+		return nil
+	}
+	var found *Conversation
+	for _, c := range m.Conversations {
+		if c.ID == id {
+			return c
+		}
+		if strings.HasPrefix(c.ID, id) {
+			if found != nil {
+				return nil
+			}
+			found = c
+		}
+	}
+	return found
+}
+
+func (m *ConversationManager) Remove(conv *Conversation) {
+	for i, c := range m.Conversations {
+		if c == conv {
+			m.Conversations = append(m.Conversations[:i], m.Conversations[i+1:]...)
+			if i < m.Idx {
+				m.Idx--
+			}
+			if m.Idx >= len(m.Conversations) {
+				m.Idx = len(m.Conversations) - 1
+			}
+			return
+		}
+	}
+}
+
 func (m *ConversationManager) RemoveCurr() {
 	if len(m.Conversations) == 0 {
 		return
@@ -150,21 +210,131 @@ func (m *ConversationManager) Next() *Conversation {
 }
 
 type QnA struct {
-	Question string `json:"question"`
-	Answer   string `json:"answer"`
+	Question   string      `json:"question"`
+	Images     []Image     `json:"images,omitempty"`
+	ToolRounds []ToolRound `json:"tool_rounds,omitempty"`
+	Answer     string      `json:"answer"`
+}
+
+// ToolRound is an assistant message that requests tool calls, along with the results of these calls.
+type ToolRound struct {
+	Content string     `json:"content,omitempty"`
+	Calls   []ToolCall `json:"calls"`
+}
+
+type ToolCall struct {
+	ID        string `json:"id"`
+	Name      string `json:"name"`
+	Arguments string `json:"arguments"`
+	Result    string `json:"result"`
+	Done      bool   `json:"done"`
+}
+
+func (c ToolCall) ToolCall() openai.ToolCall {
+	return openai.ToolCall{
+		ID:   c.ID,
+		Type: openai.ToolTypeFunction,
+		Function: openai.FunctionCall{
+			Name:      c.Name,
+			Arguments: c.Arguments,
+		},
+	}
+}
+
+// messages returns the messages of the QnA, along with the error of the images that can't be read.
+func (q QnA) messages(withAnswer bool) ([]openai.ChatCompletionMessage, error) {
+	user, err := q.userMessage()
+	messages := []openai.ChatCompletionMessage{user}
+	for _, round := range q.ToolRounds {
+		calls := make([]openai.ToolCall, 0, len(round.Calls))
+		for _, call := range round.Calls {
+			calls = append(calls, call.ToolCall())
+		}
+		messages = append(
+			messages, openai.ChatCompletionMessage{
+				Role:      openai.ChatMessageRoleAssistant,
+				Content:   round.Content,
+				ToolCalls: calls,
+			},
+		)
+		for _, call := range round.Calls {
+			messages = append(
+				messages, openai.ChatCompletionMessage{
+					Role:       openai.ChatMessageRoleTool,
+					Content:    call.Result,
+					ToolCallID: call.ID,
+				},
+			)
+		}
+	}
+	if withAnswer {
+		messages = append(
+			messages, openai.ChatCompletionMessage{
+				Role:    openai.ChatMessageRoleAssistant,
+				Content: q.Answer,
+			},
+		)
+	}
+	return messages, err
+}
+
+// userMessage returns the question with its images, the images that can't be read are left out and reported.
+func (q QnA) userMessage() (openai.ChatCompletionMessage, error) {
+	if len(q.Images) == 0 {
+		return openai.ChatCompletionMessage{
+			Role:    openai.ChatMessageRoleUser,
+			Content: q.Question,
+		}, nil
+	}
+	parts := make([]openai.ChatMessagePart, 0, len(q.Images)+1)
+	parts = append(
+		parts, openai.ChatMessagePart{
+			Type: openai.ChatMessagePartTypeText,
+			Text: q.Question,
+		},
+	)
+	var errs []error
+	for _, img := range q.Images {
+		url, err := img.DataURL()
+		if err != nil {
+			// Image may be removed from the images dir.
+			errs = append(errs, err)
+			continue
+		}
+		parts = append(
+			parts, openai.ChatMessagePart{
+				Type:     openai.ChatMessagePartTypeImageURL,
+				ImageURL: &openai.ChatMessageImageURL{URL: url, Detail: openai.ImageURLDetailAuto},
+			},
+		)
+	}
+	return openai.ChatCompletionMessage{
+		Role:         openai.ChatMessageRoleUser,
+		MultiContent: parts,
+	}, errors.Join(errs...)
 }
 
 type Conversation struct {
 	manager       *ConversationManager
 	contextTokens int
+	ID            string             `json:"id"`
+	CreatedAt     time.Time          `json:"created_at"`
+	UpdatedAt     time.Time          `json:"updated_at"`
 	Config        ConversationConfig `json:"config"`
 	Forgotten     []QnA              `json:"forgotten,omitempty"`
 	Context       []QnA              `json:"context,omitempty"`
 	Pending       *QnA               `json:"pending,omitempty"`
 }
 
-func (c *Conversation) AddQuestion(q string) {
-	c.Pending = &QnA{Question: q}
+func (c *Conversation) AddQuestion(q string, images ...Image) {
+	c.Pending = &QnA{Question: q, Images: images}
+	c.UpdatedAt = time.Now()
+	c.contextTokens = 0
+}
+
+// DiscardPending removes the pending question without recording it.
+func (c *Conversation) DiscardPending() {
+	c.Pending = nil
 	c.contextTokens = 0
 }
 
@@ -174,6 +344,15 @@ func (c *Conversation) UpdatePending(ans string, done bool) {
 	}
 	c.Pending.Answer += ans
 	if done {
+		for i := range c.Pending.ToolRounds {
+			calls := c.Pending.ToolRounds[i].Calls
+			for j := range calls {
+				if !calls[j].Done {
+					calls[j].Result = "error: tool call was canceled"
+					calls[j].Done = true
+				}
+			}
+		}
 		c.Context = append(c.Context, *c.Pending)
 		c.contextTokens = 0
 		if len(c.Context) > c.Config.ContextLength {
@@ -181,10 +360,72 @@ func (c *Conversation) UpdatePending(ans string, done bool) {
 			c.Context = c.Context[1:]
 		}
 		c.Pending = nil
+		c.UpdatedAt = time.Now()
+	}
+}
+
+// AddToolCalls records the tool calls requested by the model for the pending question.
+// The answer received so far becomes the content of the tool calling message.
+func (c *Conversation) AddToolCalls(calls []openai.ToolCall) {
+	if c.Pending == nil {
+		return
+	}
+	round := ToolRound{Content: c.Pending.Answer}
+	for _, call := range calls {
+		round.Calls = append(
+			round.Calls, ToolCall{
+				ID:        call.ID,
+				Name:      call.Function.Name,
+				Arguments: call.Function.Arguments,
+			},
+		)
+	}
+	c.Pending.ToolRounds = append(c.Pending.ToolRounds, round)
+	c.Pending.Answer = ""
+	c.contextTokens = 0
+}
+
+// NextToolCall returns the first tool call of the pending question that has not been run yet.
+func (c *Conversation) NextToolCall() *ToolCall {
+	if c.Pending == nil || len(c.Pending.ToolRounds) == 0 {
+		return nil
 	}
+	round := c.Pending.ToolRounds[len(c.Pending.ToolRounds)-1]
+	for i := range round.Calls {
+		if !round.Calls[i].Done {
+			return &round.Calls[i]
+		}
+	}
+	return nil
 }
 
-func (c *Conversation) GetContextMessages() []openai.ChatCompletionMessage {
+func (c *Conversation) SetToolResult(id, result string) {
+	call := c.NextToolCall()
+	if call == nil || call.ID != id {
+		return
+	}
+	call.Result = result
+	call.Done = true
+	c.contextTokens = 0
+}
+
+// ImagesError reports the images of earlier questions that can't be read, e.g. removed from the images dir. They
+// are left out of the messages, which can be sent without them.
+type ImagesError struct {
+	Err error
+}
+
+func (e *ImagesError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *ImagesError) Unwrap() error {
+	return e.Err
+}
+
+// GetContextMessages returns the messages to send. An error about the images of the pending question means the
+// question can't be asked, while an *ImagesError only reports the images of earlier questions left out.
+func (c *Conversation) GetContextMessages() ([]openai.ChatCompletionMessage, error) {
 	messages := make([]openai.ChatCompletionMessage, 0, 2*len(c.Context)+2)
 	messages = append(
 		messages, openai.ChatCompletionMessage{
@@ -192,34 +433,29 @@ func (c *Conversation) GetContextMessages() []openai.ChatCompletionMessage {
 			Content: c.manager.globalConf.LookupPrompt(c.Config.Prompt),
 		},
 	)
-	for _, c := range c.Context {
-		messages = append(
-			messages, openai.ChatCompletionMessage{
-				Role:    openai.ChatMessageRoleUser,
-				Content: c.Question,
-			},
-		)
-		messages = append(
-			messages, openai.ChatCompletionMessage{
-				Role:    openai.ChatMessageRoleAssistant,
-				Content: c.Answer,
-			},
-		)
+	var errs []error
+	for _, q := range c.Context {
+		msgs, err := q.messages(true)
+		messages = append(messages, msgs...)
+		errs = append(errs, err)
 	}
 	if c.Pending != nil {
-		messages = append(
-			messages, openai.ChatCompletionMessage{
-				Role:    openai.ChatMessageRoleUser,
-				Content: c.Pending.Question,
-			},
-		)
+		msgs, err := c.Pending.messages(false)
+		if err != nil {
+			return nil, err
+		}
+		messages = append(messages, msgs...)
 	}
-	return messages
+	if err := errors.Join(errs...); err != nil {
+		return messages, &ImagesError{Err: err}
+	}
+	return messages, nil
 }
 
 func (c *Conversation) GetContextTokens() int {
 	if c.contextTokens == 0 {
-		c.contextTokens = tokenizer.CountMessagesTokens(c.Config.Model, c.GetContextMessages())
+		messages, _ := c.GetContextMessages()
+		c.contextTokens = tokenizer.CountMessagesTokens(c.Config.Model, messages)
 	}
 	return c.contextTokens
 }
@@ -252,6 +488,18 @@ func (c *Conversation) Len() int {
 	return l
 }
 
+// Title is the first line of the first question.
+func (c *Conversation) Title() string {
+	title := strings.TrimSpace(c.GetQuestion(0))
+	if i := strings.IndexByte(title, '\n'); i >= 0 {
+		title = title[:i]
+	}
+	if r := []rune(title); len(r) > 60 {
+		title = string(r[:60]) + "..."
+	}
+	return title
+}
+
 func (c *Conversation) GetQuestion(idx int) string {
 	if idx < 0 || idx >= c.Len() {
 		return ""
@@ -259,5 +507,9 @@ func (c *Conversation) GetQuestion(idx int) string {
 	if idx < len(c.Forgotten) {
 		return c.Forgotten[idx].Question
 	}
-	return c.Context[idx-len(c.Forgotten)].Question
+	idx -= len(c.Forgotten)
+	if idx < len(c.Context) {
+		return c.Context[idx].Question
+	}
+	return c.Pending.Question
 }
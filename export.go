@@ -0,0 +1,53 @@
+package chatgpt
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Markdown renders the conversation as a markdown document.
+func (c *Conversation) Markdown() string {
+	var sb strings.Builder
+	title := c.Title()
+	if title == "" {
+		title = "Conversation " + c.ID
+	}
+	_, _ = fmt.Fprintf(&sb, "# %s\n\n", title)
+	_, _ = fmt.Fprintf(&sb, "- id: `%s`\n", c.ID)
+	_, _ = fmt.Fprintf(&sb, "- model: `%s`\n", c.Config.Model)
+	_, _ = fmt.Fprintf(&sb, "- prompt: `%s`\n", c.Config.Prompt)
+	if !c.CreatedAt.IsZero() {
+		_, _ = fmt.Fprintf(&sb, "- created at: %s\n", c.CreatedAt.Format("2006-01-02 15:04"))
+	}
+
+	writeQnA := func(q QnA) {
+		sb.WriteString("\n## You\n\n")
+		sb.WriteString(EnsureTrailingNewline(q.Question))
+		for _, img := range q.Images {
+			_, _ = fmt.Fprintf(&sb, "\n_image `%s`_\n", img.ShortHash())
+		}
+		for _, round := range q.ToolRounds {
+			if round.Content != "" {
+				sb.WriteString("\n## ChatGPT\n\n")
+				sb.WriteString(EnsureTrailingNewline(round.Content))
+			}
+			for _, call := range round.Calls {
+				_, _ = fmt.Fprintf(&sb, "\n> tool `%s(%s)`\n", call.Name, call.Arguments)
+			}
+		}
+		if q.Answer != "" {
+			sb.WriteString("\n## ChatGPT\n\n")
+			sb.WriteString(EnsureTrailingNewline(q.Answer))
+		}
+	}
+	for _, q := range c.Forgotten {
+		writeQnA(q)
+	}
+	for _, q := range c.Context {
+		writeQnA(q)
+	}
+	if c.Pending != nil {
+		writeQnA(*c.Pending)
+	}
+	return sb.String()
+}
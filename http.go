@@ -0,0 +1,164 @@
+package chatgpt
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"sync/atomic"
+	"time"
+
+	"github.com/mitchellh/go-homedir"
+)
+
+// HTTPConfig configures the HTTP client used to reach the API.
+type HTTPConfig struct {
+	// Proxy is a http, https or socks5 URL, HTTP_PROXY and HTTPS_PROXY environment variables are used by default.
+	Proxy string `json:"proxy,omitempty"`
+	// CACert is a PEM bundle trusted in addition to the system roots.
+	CACert string `json:"ca_cert,omitempty"`
+	// ClientCert and ClientKey are PEM files presented to mTLS gateways.
+	ClientCert string            `json:"client_cert,omitempty"`
+	ClientKey  string            `json:"client_key,omitempty"`
+	Headers    map[string]string `json:"headers,omitempty"`
+	// ConnectTimeout limits establishing the connection, including the TLS handshake.
+	ConnectTimeout Duration `json:"connect_timeout,omitempty"`
+	// ReadTimeout limits waiting for the response, and for each chunk of a streamed response.
+	ReadTimeout Duration `json:"read_timeout,omitempty"`
+}
+
+func newHTTPClient(conf HTTPConfig) (*http.Client, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if conf.Proxy != "" {
+		proxy, err := url.Parse(conf.Proxy)
+		if err != nil {
+			return nil, fmt.Errorf("invalid proxy: %w", err)
+		}
+		switch proxy.Scheme {
+		case "http", "https", "socks5", "socks5h":
+		default:
+			return nil, fmt.Errorf("unsupported proxy scheme: %s", proxy.Scheme)
+		}
+		transport.Proxy = http.ProxyURL(proxy)
+	}
+
+	tlsConf := &tls.Config{MinVersion: tls.VersionTLS12}
+	if conf.CACert != "" {
+		path, _ := homedir.Expand(conf.CACert)
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CA cert: %w", err)
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(data) {
+			return nil, fmt.Errorf("no certificates found in %s", path)
+		}
+		tlsConf.RootCAs = pool
+	}
+	if conf.ClientCert != "" || conf.ClientKey != "" {
+		if conf.ClientCert == "" || conf.ClientKey == "" {
+			return nil, errors.New("both client_cert and client_key are required")
+		}
+		certPath, _ := homedir.Expand(conf.ClientCert)
+		keyPath, _ := homedir.Expand(conf.ClientKey)
+		cert, err := tls.LoadX509KeyPair(certPath, keyPath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load client cert: %w", err)
+		}
+		tlsConf.Certificates = []tls.Certificate{cert}
+	}
+	transport.TLSClientConfig = tlsConf
+
+	if timeout := time.Duration(conf.ConnectTimeout); timeout > 0 {
+		dialer := &net.Dialer{Timeout: timeout, KeepAlive: 30 * time.Second}
+		transport.DialContext = dialer.DialContext
+		transport.TLSHandshakeTimeout = timeout
+	}
+	if timeout := time.Duration(conf.ReadTimeout); timeout > 0 {
+		transport.ResponseHeaderTimeout = timeout
+	}
+
+	return &http.Client{
+		Transport: &clientTransport{
+			base:        transport,
+			headers:     conf.Headers,
+			readTimeout: time.Duration(conf.ReadTimeout),
+		},
+	}, nil
+}
+
+// clientTransport adds the custom headers to requests, and limits the idle time while reading response bodies.
+// A timeout for the whole request doesn't work for streamed answers, which can take minutes.
+type clientTransport struct {
+	base        http.RoundTripper
+	headers     map[string]string
+	readTimeout time.Duration
+}
+
+func (t *clientTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if len(t.headers) > 0 {
+		req = req.Clone(req.Context())
+		for k, v := range t.headers {
+			req.Header.Set(k, v)
+		}
+	}
+	resp, err := t.base.RoundTrip(req)
+	if err != nil || t.readTimeout <= 0 {
+		return resp, err
+	}
+	resp.Body = newIdleTimeoutBody(resp.Body, t.readTimeout)
+	return resp, nil
+}
+
+// readTimeoutError implements net.Error, so the request is retried.
+type readTimeoutError struct {
+	timeout time.Duration
+}
+
+func (e readTimeoutError) Error() string {
+	return fmt.Sprintf("read timeout: no data received in %s", e.timeout)
+}
+
+func (e readTimeoutError) Timeout() bool   { return true }
+func (e readTimeoutError) Temporary() bool { return true }
+
+// idleTimeoutBody closes the body when no data is received within the timeout.
+type idleTimeoutBody struct {
+	body     io.ReadCloser
+	timeout  time.Duration
+	timer    *time.Timer
+	timedOut atomic.Bool
+}
+
+func newIdleTimeoutBody(body io.ReadCloser, timeout time.Duration) *idleTimeoutBody {
+	b := &idleTimeoutBody{body: body, timeout: timeout}
+	b.timer = time.AfterFunc(
+		timeout, func() {
+			b.timedOut.Store(true)
+			_ = body.Close()
+		},
+	)
+	return b
+}
+
+func (b *idleTimeoutBody) Read(p []byte) (int, error) {
+	n, err := b.body.Read(p)
+	if b.timedOut.Load() {
+		return n, readTimeoutError{b.timeout}
+	}
+	b.timer.Reset(b.timeout)
+	return n, err
+}
+
+func (b *idleTimeoutBody) Close() error {
+	b.timer.Stop()
+	return b.body.Close()
+}
@@ -0,0 +1,96 @@
+package chatgpt
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+var imageMIMETypes = map[string]bool{
+	"image/png":  true,
+	"image/jpeg": true,
+	"image/gif":  true,
+	"image/webp": true,
+}
+
+// Image is an image attached to a question. The image data is stored
+// separately in the images directory, named by its content hash.
+type Image struct {
+	Hash     string `json:"hash"`
+	MIMEType string `json:"mime_type"`
+}
+
+func ImagesDir() string {
+	return filepath.Join(configDir(), "images")
+}
+
+// SaveImage copies a local image file into the images directory.
+func SaveImage(path string) (Image, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Image{}, fmt.Errorf("failed to read image: %w", err)
+	}
+	mimeType := http.DetectContentType(data)
+	if !imageMIMETypes[mimeType] {
+		return Image{}, fmt.Errorf("unsupported image type %s: %s", mimeType, path)
+	}
+
+	sum := sha256.Sum256(data)
+	img := Image{Hash: hex.EncodeToString(sum[:]), MIMEType: mimeType}
+
+	dst := img.path()
+	if _, err := os.Stat(dst); err == nil {
+		return img, nil
+	}
+	err = os.MkdirAll(ImagesDir(), 0o700)
+	if err != nil {
+		return Image{}, fmt.Errorf("failed to create images dir: %w", err)
+	}
+	err = os.WriteFile(dst, data, 0o600)
+	if err != nil {
+		return Image{}, fmt.Errorf("failed to save image: %w", err)
+	}
+	return img, nil
+}
+
+func (i Image) path() string {
+	return filepath.Join(ImagesDir(), i.Hash)
+}
+
+func (i Image) Data() ([]byte, error) {
+	return os.ReadFile(i.path())
+}
+
+// dataURLs caches the encoded images by hash, an image never changes since it's named by its content.
+var dataURLs sync.Map
+
+// DataURL returns the image encoded as a base64 data URL, which can be sent to the API directly.
+func (i Image) DataURL() (string, error) {
+	if url, ok := dataURLs.Load(i.Hash); ok {
+		return url.(string), nil
+	}
+	data, err := i.Data()
+	if err != nil {
+		return "", fmt.Errorf("failed to read image %s: %w", i.ShortHash(), err)
+	}
+	var sb strings.Builder
+	sb.WriteString("data:")
+	sb.WriteString(i.MIMEType)
+	sb.WriteString(";base64,")
+	sb.WriteString(base64.StdEncoding.EncodeToString(data))
+	dataURLs.Store(i.Hash, sb.String())
+	return sb.String(), nil
+}
+
+func (i Image) ShortHash() string {
+	if len(i.Hash) > 8 {
+		return i.Hash[:8]
+	}
+	return i.Hash
+}
@@ -0,0 +1,128 @@
+package chatgpt
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+
+	"github.com/j178/chatgpt/mcp"
+	"github.com/j178/chatgpt/tools"
+)
+
+var invalidToolNameChars = regexp.MustCompile(`[^a-zA-Z0-9_-]`)
+
+// maxToolNameLength is the limit of function names in the API.
+const maxToolNameLength = 64
+
+// mcpToolName namespaces a tool name with its server name, and makes it a valid function name. Names that are too
+// long or already taken, e.g. because invalid characters are replaced, get a hash of the server and tool names.
+func mcpToolName(server, tool string, taken func(string) bool) string {
+	name := invalidToolNameChars.ReplaceAllString(server+"__"+tool, "_")
+	if len(name) <= maxToolNameLength && !taken(name) {
+		return name
+	}
+	sum := sha256.Sum256([]byte(server + "\x00" + tool))
+	suffix := "_" + hex.EncodeToString(sum[:4])
+	return name[:min(len(name), maxToolNameLength-len(suffix))] + suffix
+}
+
+// ConnectMCPServers connects to the configured MCP servers, and registers their tools. When a server fails, the
+// servers already connected are closed.
+func (c *ChatGPT) ConnectMCPServers(clientVersion string) (err error) {
+	defer func() {
+		if err != nil {
+			c.Close()
+			c.tools = tools.Builtin()
+		}
+	}()
+
+	names := make([]string, 0, len(c.globalConf.MCPServers))
+	for name := range c.globalConf.MCPServers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var httpClient *http.Client
+	if len(names) > 0 {
+		// MCP servers share the proxy, TLS and timeout settings, but not the headers meant for the API.
+		httpConf := c.globalConf.HTTP
+		httpConf.Headers = nil
+		httpClient, err = newHTTPClient(httpConf)
+		if err != nil {
+			return fmt.Errorf("failed to create HTTP client: %w", err)
+		}
+	}
+
+	ctx := context.Background()
+	for _, name := range names {
+		conf := c.globalConf.MCPServers[name]
+		var (
+			client *mcp.Client
+			err    error
+		)
+		switch {
+		case conf.Command != "":
+			client, err = mcp.NewStdioClient(ctx, conf.Command, conf.Args, conf.Env, clientVersion)
+		case conf.URL != "":
+			client, err = mcp.NewHTTPClient(ctx, httpClient, conf.URL, conf.Headers, clientVersion)
+		default:
+			err = errors.New("either command or url is required")
+		}
+		if err != nil {
+			return fmt.Errorf("failed to connect to MCP server %s: %w", name, err)
+		}
+		c.mcpClients = append(c.mcpClients, client)
+
+		mcpTools, err := client.ListTools(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to list tools of MCP server %s: %w", name, err)
+		}
+		for _, t := range mcpTools {
+			toolName := mcpToolName(
+				name, t.Name, func(n string) bool {
+					_, ok := c.tools.Get(n)
+					return ok
+				},
+			)
+			c.tools.Register(newMCPTool(client, toolName, conf, t))
+		}
+	}
+	return nil
+}
+
+func newMCPTool(client *mcp.Client, name string, conf MCPServerConfig, t mcp.Tool) tools.Tool {
+	params := t.InputSchema
+	if len(params) == 0 {
+		params = json.RawMessage(`{"type": "object", "properties": {}}`)
+	}
+	return tools.Tool{
+		Name:        name,
+		Description: t.Description,
+		Parameters:  params,
+		SideEffect:  !conf.Trusted && !t.Annotations.ReadOnlyHint,
+		Run: func(ctx context.Context, args json.RawMessage) (string, error) {
+			result, err := client.CallTool(ctx, t.Name, args)
+			if err != nil {
+				return "", err
+			}
+			if result.IsError {
+				return "", errors.New(result.Text())
+			}
+			return result.Text(), nil
+		},
+	}
+}
+
+// Close disconnects from the MCP servers.
+func (c *ChatGPT) Close() {
+	for _, client := range c.mcpClients {
+		_ = client.Close()
+	}
+	c.mcpClients = nil
+}
@@ -0,0 +1,185 @@
+// Package mcp implements a minimal Model Context Protocol client, which is enough to discover and call tools.
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	ProtocolVersion = "2025-03-26"
+	callTimeout     = 2 * time.Minute
+)
+
+type request struct {
+	JSONRPC string `json:"jsonrpc"`
+	ID      *int64 `json:"id,omitempty"`
+	Method  string `json:"method"`
+	Params  any    `json:"params,omitempty"`
+}
+
+// message is any JSON-RPC message received from the server.
+type message struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      *int64          `json:"id,omitempty"`
+	Method  string          `json:"method,omitempty"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Error   *Error          `json:"error,omitempty"`
+}
+
+type Error struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("mcp error %d: %s", e.Code, e.Message)
+}
+
+type transport interface {
+	// Call sends a request and waits for its response.
+	Call(ctx context.Context, req request) (json.RawMessage, error)
+	Notify(ctx context.Context, req request) error
+	Close() error
+}
+
+type Client struct {
+	transport transport
+	nextID    atomic.Int64
+}
+
+type ToolAnnotations struct {
+	ReadOnlyHint    bool `json:"readOnlyHint,omitempty"`
+	DestructiveHint bool `json:"destructiveHint,omitempty"`
+}
+
+type Tool struct {
+	Name        string          `json:"name"`
+	Description string          `json:"description,omitempty"`
+	InputSchema json.RawMessage `json:"inputSchema"`
+	Annotations ToolAnnotations `json:"annotations"`
+}
+
+type Content struct {
+	Type     string `json:"type"`
+	Text     string `json:"text,omitempty"`
+	MimeType string `json:"mimeType,omitempty"`
+	Resource *struct {
+		URI  string `json:"uri"`
+		Text string `json:"text,omitempty"`
+	} `json:"resource,omitempty"`
+}
+
+type CallToolResult struct {
+	Content []Content `json:"content"`
+	IsError bool      `json:"isError,omitempty"`
+}
+
+// Text joins the contents of a tool result into plain text.
+func (r CallToolResult) Text() string {
+	var parts []string
+	for _, c := range r.Content {
+		switch {
+		case c.Type == "text":
+			parts = append(parts, c.Text)
+		case c.Type == "resource" && c.Resource != nil:
+			if c.Resource.Text != "" {
+				parts = append(parts, c.Resource.Text)
+			} else {
+				parts = append(parts, fmt.Sprintf("[resource %s]", c.Resource.URI))
+			}
+		default:
+			parts = append(parts, fmt.Sprintf("[%s content %s]", c.Type, c.MimeType))
+		}
+	}
+	return strings.Join(parts, "\n")
+}
+
+func newClient(ctx context.Context, t transport, clientVersion string) (*Client, error) {
+	c := &Client{transport: t}
+	err := c.initialize(ctx, clientVersion)
+	if err != nil {
+		_ = t.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+func (c *Client) call(ctx context.Context, method string, params any, result any) error {
+	ctx, cancel := context.WithTimeout(ctx, callTimeout)
+	defer cancel()
+
+	id := c.nextID.Add(1)
+	raw, err := c.transport.Call(ctx, request{JSONRPC: "2.0", ID: &id, Method: method, Params: params})
+	if err != nil {
+		return fmt.Errorf("%s: %w", method, err)
+	}
+	if result == nil {
+		return nil
+	}
+	err = json.Unmarshal(raw, result)
+	if err != nil {
+		return fmt.Errorf("%s: invalid result: %w", method, err)
+	}
+	return nil
+}
+
+func (c *Client) initialize(ctx context.Context, clientVersion string) error {
+	params := map[string]any{
+		"protocolVersion": ProtocolVersion,
+		"capabilities":    map[string]any{},
+		"clientInfo": map[string]any{
+			"name":    "chatgpt",
+			"version": clientVersion,
+		},
+	}
+	err := c.call(ctx, "initialize", params, nil)
+	if err != nil {
+		return err
+	}
+	return c.transport.Notify(ctx, request{JSONRPC: "2.0", Method: "notifications/initialized"})
+}
+
+func (c *Client) ListTools(ctx context.Context) ([]Tool, error) {
+	var (
+		tools  []Tool
+		cursor string
+	)
+	for {
+		var params map[string]any
+		if cursor != "" {
+			params = map[string]any{"cursor": cursor}
+		}
+		var result struct {
+			Tools      []Tool `json:"tools"`
+			NextCursor string `json:"nextCursor,omitempty"`
+		}
+		err := c.call(ctx, "tools/list", params, &result)
+		if err != nil {
+			return nil, err
+		}
+		tools = append(tools, result.Tools...)
+		if result.NextCursor == "" {
+			return tools, nil
+		}
+		cursor = result.NextCursor
+	}
+}
+
+func (c *Client) CallTool(ctx context.Context, name string, args json.RawMessage) (CallToolResult, error) {
+	var result CallToolResult
+	params := map[string]any{
+		"name":      name,
+		"arguments": args,
+	}
+	err := c.call(ctx, "tools/call", params, &result)
+	return result, err
+}
+
+func (c *Client) Close() error {
+	return c.transport.Close()
+}
@@ -0,0 +1,216 @@
+package mcp
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"slices"
+	"sync"
+	"testing"
+)
+
+// stubTools are the tools of the stub server, listed in two pages.
+var stubTools = []Tool{
+	{Name: "echo", Description: "Echo the text", InputSchema: json.RawMessage(`{"type":"object"}`)},
+	{Name: "fail", Annotations: ToolAnnotations{ReadOnlyHint: true}},
+}
+
+// stubHandle answers a JSON-RPC request like an MCP server, notifications get a nil result.
+func stubHandle(req message, params json.RawMessage) any {
+	if req.ID == nil {
+		return nil
+	}
+	resp := map[string]any{"jsonrpc": "2.0", "id": *req.ID}
+	switch req.Method {
+	case "initialize":
+		resp["result"] = map[string]any{
+			"protocolVersion": ProtocolVersion,
+			"capabilities":    map[string]any{"tools": map[string]any{}},
+			"serverInfo":      map[string]any{"name": "stub", "version": "1.0"},
+		}
+	case "tools/list":
+		var p struct {
+			Cursor string `json:"cursor"`
+		}
+		_ = json.Unmarshal(params, &p)
+		if p.Cursor == "" {
+			resp["result"] = map[string]any{"tools": stubTools[:1], "nextCursor": "2"}
+		} else {
+			resp["result"] = map[string]any{"tools": stubTools[1:]}
+		}
+	case "tools/call":
+		var p struct {
+			Name      string `json:"name"`
+			Arguments struct {
+				Text string `json:"text"`
+			} `json:"arguments"`
+		}
+		_ = json.Unmarshal(params, &p)
+		if p.Name == "fail" {
+			resp["result"] = map[string]any{"content": []Content{{Type: "text", Text: "failed"}}, "isError": true}
+		} else {
+			resp["result"] = map[string]any{"content": []Content{{Type: "text", Text: p.Arguments.Text}}}
+		}
+	default:
+		resp["error"] = Error{Code: -32601, Message: "method not found"}
+	}
+	return resp
+}
+
+type stubRequest struct {
+	message
+	Params json.RawMessage `json:"params"`
+}
+
+// TestMain runs the stub server over stdio when the test binary is launched as a server.
+func TestMain(m *testing.M) {
+	if os.Getenv("MCP_STUB_SERVER") == "1" {
+		scanner := bufio.NewScanner(os.Stdin)
+		for scanner.Scan() {
+			var req stubRequest
+			if err := json.Unmarshal(scanner.Bytes(), &req); err != nil {
+				continue
+			}
+			if resp := stubHandle(req.message, req.Params); resp != nil {
+				data, _ := json.Marshal(resp)
+				fmt.Println(string(data))
+			}
+		}
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+// newStubHTTPServer serves the stub over the streamable HTTP transport, tools/call is answered with server-sent
+// events and the other requests with JSON.
+func newStubHTTPServer(t *testing.T) (*httptest.Server, *[]string) {
+	var (
+		mu       sync.Mutex
+		requests []string
+	)
+	srv := httptest.NewServer(
+		http.HandlerFunc(
+			func(w http.ResponseWriter, r *http.Request) {
+				mu.Lock()
+				requests = append(requests, r.Method+" "+r.Header.Get("Mcp-Session-Id")+" "+r.Header.Get("X-Token"))
+				mu.Unlock()
+				if r.Method == http.MethodDelete {
+					return
+				}
+				var req stubRequest
+				if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+					http.Error(w, err.Error(), http.StatusBadRequest)
+					return
+				}
+				resp := stubHandle(req.message, req.Params)
+				if resp == nil {
+					w.WriteHeader(http.StatusAccepted)
+					return
+				}
+				data, _ := json.Marshal(resp)
+				if req.Method == "initialize" {
+					w.Header().Set("Mcp-Session-Id", "session-1")
+				}
+				if req.Method == "tools/call" {
+					w.Header().Set("Content-Type", "text/event-stream")
+					_, _ = fmt.Fprintf(w, "event: message\ndata: {\"jsonrpc\":\"2.0\",\"method\":\"notifications/progress\"}\n\n")
+					_, _ = fmt.Fprintf(w, "data: %s\n\n", data)
+					return
+				}
+				w.Header().Set("Content-Type", "application/json")
+				_, _ = w.Write(data)
+			},
+		),
+	)
+	t.Cleanup(srv.Close)
+	return srv, &requests
+}
+
+func testClient(t *testing.T, c *Client) {
+	t.Helper()
+	ctx := context.Background()
+	tools, err := c.ListTools(ctx)
+	if err != nil {
+		t.Fatalf("ListTools: %v", err)
+	}
+	names := make([]string, 0, len(tools))
+	for _, tool := range tools {
+		names = append(names, tool.Name)
+	}
+	if !slices.Equal(names, []string{"echo", "fail"}) {
+		t.Errorf("ListTools = %v, want [echo fail]", names)
+	}
+	if !tools[1].Annotations.ReadOnlyHint {
+		t.Errorf("annotations of fail are not read")
+	}
+
+	result, err := c.CallTool(ctx, "echo", json.RawMessage(`{"text":"hello"}`))
+	if err != nil {
+		t.Fatalf("CallTool: %v", err)
+	}
+	if result.IsError || result.Text() != "hello" {
+		t.Errorf("CallTool(echo) = %+v, want hello", result)
+	}
+	result, err = c.CallTool(ctx, "fail", nil)
+	if err != nil {
+		t.Fatalf("CallTool: %v", err)
+	}
+	if !result.IsError || result.Text() != "failed" {
+		t.Errorf("CallTool(fail) = %+v, want an error result", result)
+	}
+}
+
+func TestHTTPClient(t *testing.T) {
+	srv, requests := newStubHTTPServer(t)
+	c, err := NewHTTPClient(context.Background(), nil, srv.URL, map[string]string{"X-Token": "secret"}, "test")
+	if err != nil {
+		t.Fatalf("NewHTTPClient: %v", err)
+	}
+	testClient(t, c)
+	if err := c.Close(); err != nil {
+		t.Errorf("Close: %v", err)
+	}
+
+	want := []string{
+		"POST  secret",          // initialize
+		"POST session-1 secret", // notifications/initialized
+		"POST session-1 secret", // tools/list
+		"POST session-1 secret", // tools/list, page 2
+		"POST session-1 secret", // tools/call
+		"POST session-1 secret", // tools/call
+		"DELETE session-1 secret",
+	}
+	if !slices.Equal(*requests, want) {
+		t.Errorf("requests = %q, want %q", *requests, want)
+	}
+}
+
+func TestHTTPClientError(t *testing.T) {
+	srv := httptest.NewServer(http.NotFoundHandler())
+	defer srv.Close()
+	_, err := NewHTTPClient(context.Background(), nil, srv.URL, nil, "test")
+	if err == nil {
+		t.Fatal("NewHTTPClient succeeded with a server answering 404")
+	}
+}
+
+func TestStdioClient(t *testing.T) {
+	c, err := NewStdioClient(
+		context.Background(),
+		os.Args[0],
+		[]string{"-test.run=^$"},
+		map[string]string{"MCP_STUB_SERVER": "1"},
+		"test",
+	)
+	if err != nil {
+		t.Fatalf("NewStdioClient: %v", err)
+	}
+	testClient(t, c)
+	if err := c.Close(); err != nil {
+		t.Errorf("Close: %v", err)
+	}
+}
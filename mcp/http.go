@@ -0,0 +1,164 @@
+package mcp
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// httpTransport implements the streamable HTTP transport, each message is POSTed to the server endpoint,
+// and the response is either a JSON object or a stream of server-sent events.
+type httpTransport struct {
+	url     string
+	headers map[string]string
+	client  *http.Client
+
+	mu        sync.Mutex
+	sessionID string
+}
+
+// NewHTTPClient connects to a server over HTTP and initializes the connection. The requests are sent with
+// httpClient, which carries the proxy and TLS settings, or http.DefaultClient when it's nil.
+func NewHTTPClient(
+	ctx context.Context,
+	httpClient *http.Client,
+	url string,
+	headers map[string]string,
+	clientVersion string,
+) (*Client, error) {
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	t := &httpTransport{
+		url:     url,
+		headers: headers,
+		client:  httpClient,
+	}
+	return newClient(ctx, t, clientVersion)
+}
+
+func (t *httpTransport) post(ctx context.Context, req request) (*http.Response, error) {
+	data, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, t.url, bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set("Accept", "application/json, text/event-stream")
+	for k, v := range t.headers {
+		httpReq.Header.Set(k, v)
+	}
+	t.mu.Lock()
+	if t.sessionID != "" {
+		httpReq.Header.Set("Mcp-Session-Id", t.sessionID)
+	}
+	t.mu.Unlock()
+
+	resp, err := t.client.Do(httpReq)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= 400 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		_ = resp.Body.Close()
+		return nil, fmt.Errorf("http status %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+	if id := resp.Header.Get("Mcp-Session-Id"); id != "" {
+		t.mu.Lock()
+		t.sessionID = id
+		t.mu.Unlock()
+	}
+	return resp, nil
+}
+
+func (t *httpTransport) Call(ctx context.Context, req request) (json.RawMessage, error) {
+	resp, err := t.post(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	var msg message
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if mediaType == "text/event-stream" {
+		msg, err = readEventStream(resp.Body, *req.ID)
+	} else {
+		err = json.NewDecoder(resp.Body).Decode(&msg)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if msg.Error != nil {
+		return nil, msg.Error
+	}
+	return msg.Result, nil
+}
+
+// readEventStream reads server-sent events until the response of the given request arrives.
+func readEventStream(r io.Reader, id int64) (message, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	var data strings.Builder
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(line, "data:") {
+			data.WriteString(strings.TrimPrefix(strings.TrimPrefix(line, "data:"), " "))
+			continue
+		}
+		if line != "" || data.Len() == 0 {
+			continue
+		}
+		// Empty line ends an event.
+		var msg message
+		err := json.Unmarshal([]byte(data.String()), &msg)
+		data.Reset()
+		if err == nil && msg.Method == "" && msg.ID != nil && *msg.ID == id {
+			return msg, nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return message{}, err
+	}
+	return message{}, errClosed
+}
+
+func (t *httpTransport) Notify(ctx context.Context, req request) error {
+	resp, err := t.post(ctx, req)
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+func (t *httpTransport) Close() error {
+	t.mu.Lock()
+	sessionID := t.sessionID
+	t.mu.Unlock()
+	if sessionID == "" {
+		return nil
+	}
+	// Terminate the session explicitly, servers may not support it, so the result is ignored.
+	req, err := http.NewRequest(http.MethodDelete, t.url, nil)
+	if err != nil {
+		return nil
+	}
+	req.Header.Set("Mcp-Session-Id", sessionID)
+	for k, v := range t.headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := t.client.Do(req)
+	if err == nil {
+		_ = resp.Body.Close()
+	}
+	return nil
+}
@@ -0,0 +1,167 @@
+package mcp
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"sync"
+	"time"
+)
+
+var errClosed = errors.New("connection closed")
+
+// stdioTransport talks to a server launched as a subprocess, messages are newline-delimited JSON.
+type stdioTransport struct {
+	cmd     *exec.Cmd
+	stdin   io.WriteCloser
+	writeMu sync.Mutex
+
+	mu      sync.Mutex
+	pending map[int64]chan message
+	err     error
+	done    chan struct{}
+}
+
+// NewStdioClient launches the server command and initializes the connection.
+func NewStdioClient(ctx context.Context, command string, args []string, env map[string]string, clientVersion string) (*Client, error) {
+	cmd := exec.Command(command, args...)
+	cmd.Env = os.Environ()
+	for k, v := range env {
+		cmd.Env = append(cmd.Env, k+"="+v)
+	}
+	// Server logs go to stderr, which would mess up the TUI.
+	cmd.Stderr = io.Discard
+
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	err = cmd.Start()
+	if err != nil {
+		return nil, fmt.Errorf("failed to start %s: %w", command, err)
+	}
+
+	t := &stdioTransport{
+		cmd:     cmd,
+		stdin:   stdin,
+		pending: map[int64]chan message{},
+		done:    make(chan struct{}),
+	}
+	go t.readLoop(stdout)
+	return newClient(ctx, t, clientVersion)
+}
+
+func (t *stdioTransport) readLoop(r io.Reader) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		var msg message
+		if err := json.Unmarshal(scanner.Bytes(), &msg); err != nil {
+			continue
+		}
+		if msg.Method != "" {
+			// Server-initiated request or notification.
+			if msg.ID != nil {
+				t.reply(*msg.ID)
+			}
+			continue
+		}
+		if msg.ID == nil {
+			continue
+		}
+		t.mu.Lock()
+		ch, ok := t.pending[*msg.ID]
+		delete(t.pending, *msg.ID)
+		t.mu.Unlock()
+		if ok {
+			ch <- msg
+		}
+	}
+
+	t.mu.Lock()
+	t.err = scanner.Err()
+	if t.err == nil {
+		t.err = errClosed
+	}
+	t.mu.Unlock()
+	close(t.done)
+}
+
+// reply answers server-initiated requests, none of the client features are supported.
+func (t *stdioTransport) reply(id int64) {
+	resp := map[string]any{
+		"jsonrpc": "2.0",
+		"id":      id,
+		"error":   Error{Code: -32601, Message: "method not found"},
+	}
+	_ = t.write(resp)
+}
+
+func (t *stdioTransport) write(v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	t.writeMu.Lock()
+	defer t.writeMu.Unlock()
+	_, err = t.stdin.Write(append(data, '\n'))
+	return err
+}
+
+func (t *stdioTransport) Call(ctx context.Context, req request) (json.RawMessage, error) {
+	ch := make(chan message, 1)
+	t.mu.Lock()
+	if t.err != nil {
+		t.mu.Unlock()
+		return nil, t.err
+	}
+	t.pending[*req.ID] = ch
+	t.mu.Unlock()
+
+	err := t.write(req)
+	if err != nil {
+		t.mu.Lock()
+		delete(t.pending, *req.ID)
+		t.mu.Unlock()
+		return nil, err
+	}
+
+	select {
+	case msg := <-ch:
+		if msg.Error != nil {
+			return nil, msg.Error
+		}
+		return msg.Result, nil
+	case <-t.done:
+		return nil, t.err
+	case <-ctx.Done():
+		t.mu.Lock()
+		delete(t.pending, *req.ID)
+		t.mu.Unlock()
+		return nil, ctx.Err()
+	}
+}
+
+func (t *stdioTransport) Notify(ctx context.Context, req request) error {
+	return t.write(req)
+}
+
+func (t *stdioTransport) Close() error {
+	_ = t.stdin.Close()
+	select {
+	case <-t.done:
+	case <-time.After(2 * time.Second):
+		_ = t.cmd.Process.Kill()
+	}
+	_ = t.cmd.Wait()
+	return nil
+}
@@ -0,0 +1,120 @@
+package chatgpt
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+func TestMCPToolName(t *testing.T) {
+	none := func(string) bool { return false }
+	if got := mcpToolName("fs", "read file", none); got != "fs__read_file" {
+		t.Errorf("mcpToolName = %q, want fs__read_file", got)
+	}
+
+	taken := func(name string) bool { return name == "a_b__c" }
+	got := mcpToolName("a.b", "c", taken)
+	if got == "a_b__c" || !strings.HasPrefix(got, "a_b__c_") {
+		t.Errorf("mcpToolName of a taken name = %q, want a_b__c with a suffix", got)
+	}
+	if again := mcpToolName("a.b", "c", taken); again != got {
+		t.Errorf("mcpToolName is not stable: %q != %q", again, got)
+	}
+
+	long := strings.Repeat("x", 40)
+	a, b := mcpToolName(long, long+"1", none), mcpToolName(long, long+"2", none)
+	if len(a) > maxToolNameLength || len(b) > maxToolNameLength {
+		t.Errorf("names longer than %d: %q, %q", maxToolNameLength, a, b)
+	}
+	if a == b {
+		t.Errorf("long names collide: %q", a)
+	}
+}
+
+// newStubMCPServer serves an MCP server with a single tool over HTTP, closed counts the terminated sessions.
+func newStubMCPServer(t *testing.T, tool string) (url string, closed *atomic.Int32) {
+	closed = &atomic.Int32{}
+	srv := httptest.NewServer(
+		http.HandlerFunc(
+			func(w http.ResponseWriter, r *http.Request) {
+				if r.Method == http.MethodDelete {
+					closed.Add(1)
+					return
+				}
+				var req struct {
+					ID     *int64 `json:"id"`
+					Method string `json:"method"`
+				}
+				_ = json.NewDecoder(r.Body).Decode(&req)
+				if req.ID == nil {
+					w.WriteHeader(http.StatusAccepted)
+					return
+				}
+				var result any = map[string]any{}
+				if req.Method == "tools/list" {
+					result = map[string]any{"tools": []map[string]any{{"name": tool, "inputSchema": map[string]any{}}}}
+				}
+				w.Header().Set("Mcp-Session-Id", "session")
+				_ = json.NewEncoder(w).Encode(map[string]any{"jsonrpc": "2.0", "id": *req.ID, "result": result})
+			},
+		),
+	)
+	t.Cleanup(srv.Close)
+	return srv.URL, closed
+}
+
+func newTestBot(t *testing.T, servers map[string]MCPServerConfig) *ChatGPT {
+	t.Helper()
+	bot, err := NewChatGPT(GlobalConfig{APIKey: "sk-test", APIType: openai.APITypeOpenAI, MCPServers: servers})
+	if err != nil {
+		t.Fatalf("NewChatGPT: %v", err)
+	}
+	return bot
+}
+
+func TestConnectMCPServers(t *testing.T) {
+	url1, closed1 := newStubMCPServer(t, "c")
+	url2, closed2 := newStubMCPServer(t, "c")
+	bot := newTestBot(t, map[string]MCPServerConfig{"a.b": {URL: url1}, "a_b": {URL: url2}})
+	if err := bot.ConnectMCPServers("test"); err != nil {
+		t.Fatalf("ConnectMCPServers: %v", err)
+	}
+
+	var names []string
+	for _, def := range bot.Tools().Definitions() {
+		if strings.HasPrefix(def.Function.Name, "a_b__c") {
+			names = append(names, def.Function.Name)
+		}
+	}
+	if len(names) != 2 || names[0] == names[1] {
+		t.Errorf("tools of colliding servers = %v, want 2 different names", names)
+	}
+
+	bot.Close()
+	if closed1.Load() != 1 || closed2.Load() != 1 {
+		t.Errorf("sessions closed = %d, %d, want 1, 1", closed1.Load(), closed2.Load())
+	}
+}
+
+func TestConnectMCPServersFailure(t *testing.T) {
+	url, closed := newStubMCPServer(t, "c")
+	failing := httptest.NewServer(http.NotFoundHandler())
+	defer failing.Close()
+	bot := newTestBot(t, map[string]MCPServerConfig{"a": {URL: url}, "b": {URL: failing.URL}})
+	builtin := bot.Tools().Len()
+
+	if err := bot.ConnectMCPServers("test"); err == nil {
+		t.Fatal("ConnectMCPServers succeeded with a failing server")
+	}
+	if closed.Load() != 1 {
+		t.Errorf("the connected server was not closed")
+	}
+	if n := bot.Tools().Len(); n != builtin {
+		t.Errorf("%d tools are registered after the failure, want the %d built-in ones", n, builtin)
+	}
+}
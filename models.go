@@ -0,0 +1,233 @@
+package chatgpt
+
+import (
+	"path"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// Model features, listed in ModelInfo.Features.
+const (
+	FeatureStreaming   = "streaming"
+	FeatureSystem      = "system"    // system messages
+	FeatureDeveloper   = "developer" // instructions are sent as developer messages instead of system messages
+	FeatureTemperature = "temperature"
+	FeatureVision      = "vision" // image inputs
+	FeatureTools       = "tools"
+	FeatureReasoning   = "reasoning" // the output is limited by max_completion_tokens instead of max_tokens
+)
+
+// modelFeatures are the known features, models not in the registry are assumed to have the ones except
+// developer and reasoning.
+var modelFeatures = []string{
+	FeatureStreaming,
+	FeatureSystem,
+	FeatureDeveloper,
+	FeatureTemperature,
+	FeatureVision,
+	FeatureTools,
+	FeatureReasoning,
+}
+
+// ModelInfo describes the limits, pricing and features of a model.
+type ModelInfo struct {
+	ContextWindow   int      `json:"context_window,omitempty"`    // tokens of the input and output
+	MaxOutputTokens int      `json:"max_output_tokens,omitempty"` // tokens of the output
+	InputPrice      float64  `json:"input_price,omitempty"`       // USD per million input tokens
+	OutputPrice     float64  `json:"output_price,omitempty"`      // USD per million output tokens
+	Features        []string `json:"features,omitempty"`
+}
+
+func (m ModelInfo) Supports(feature string) bool {
+	return slices.Contains(m.Features, feature)
+}
+
+// Cost returns the cost of the usage in USD, 0 when the price is unknown.
+func (m ModelInfo) Cost(usage openai.Usage) float64 {
+	return (float64(usage.PromptTokens)*m.InputPrice + float64(usage.CompletionTokens)*m.OutputPrice) / 1e6
+}
+
+// merge overrides the fields set in o.
+func (m ModelInfo) merge(o ModelInfo) ModelInfo {
+	if o.ContextWindow != 0 {
+		m.ContextWindow = o.ContextWindow
+	}
+	if o.MaxOutputTokens != 0 {
+		m.MaxOutputTokens = o.MaxOutputTokens
+	}
+	if o.InputPrice != 0 {
+		m.InputPrice = o.InputPrice
+	}
+	if o.OutputPrice != 0 {
+		m.OutputPrice = o.OutputPrice
+	}
+	if o.Features != nil {
+		m.Features = o.Features
+	}
+	return m
+}
+
+var (
+	chatFeatures      = []string{FeatureStreaming, FeatureSystem, FeatureTemperature, FeatureTools}
+	visionFeatures    = append(slices.Clone(chatFeatures), FeatureVision)
+	reasoningFeatures = []string{FeatureStreaming, FeatureDeveloper, FeatureTools, FeatureReasoning}
+)
+
+// builtinModels are keyed by model name or glob pattern, dated snapshots like gpt-4o-2024-08-06 match their model.
+// The fields are the context window, max output tokens, input and output prices and features.
+var builtinModels = map[string]ModelInfo{
+	"gpt-4.1":       {1047576, 32768, 2, 8, visionFeatures},
+	"gpt-4.1-mini":  {1047576, 32768, 0.4, 1.6, visionFeatures},
+	"gpt-4.1-nano":  {1047576, 32768, 0.1, 0.4, visionFeatures},
+	"gpt-4o":        {128000, 16384, 2.5, 10, visionFeatures},
+	"gpt-4o-mini":   {128000, 16384, 0.15, 0.6, visionFeatures},
+	"gpt-4-turbo":   {128000, 4096, 10, 30, visionFeatures},
+	"gpt-4":         {8192, 8192, 30, 60, chatFeatures},
+	"gpt-3.5-turbo": {16385, 4096, 0.5, 1.5, chatFeatures},
+	"o1":            {200000, 100000, 15, 60, append(slices.Clone(reasoningFeatures), FeatureVision)},
+	"o1-mini":       {128000, 65536, 1.1, 4.4, []string{FeatureStreaming, FeatureReasoning}},
+	"o3":            {200000, 100000, 2, 8, append(slices.Clone(reasoningFeatures), FeatureVision)},
+	"o3-mini":       {200000, 100000, 1.1, 4.4, reasoningFeatures},
+	"o4-mini":       {200000, 100000, 1.1, 4.4, append(slices.Clone(reasoningFeatures), FeatureVision)},
+}
+
+// knownModels are the well-known chat models, which are suggested in shell completion.
+var knownModels = func() []string {
+	var models []string
+	for m := range builtinModels {
+		if !isModelPattern(m) {
+			models = append(models, m)
+		}
+	}
+	sort.Strings(models)
+	return models
+}()
+
+func isModelPattern(name string) bool {
+	return strings.ContainsAny(name, "*?[")
+}
+
+func validModelPattern(name string) bool {
+	_, err := path.Match(name, "")
+	return err == nil
+}
+
+var modelDateRe = regexp.MustCompile(`-(\d{4}-\d{2}-\d{2}|\d{4})$`)
+
+// lookupModel finds the model by exact name, then by the longest matching pattern. The provider of names like
+// "openai/gpt-4o" and the date of snapshots are removed when nothing matches.
+func lookupModel(models map[string]ModelInfo, model string) (ModelInfo, bool) {
+	base := model[strings.LastIndex(model, "/")+1:]
+	for _, name := range []string{model, base, modelDateRe.ReplaceAllString(base, "")} {
+		if info, ok := models[name]; ok {
+			return info, true
+		}
+		var found string
+		for pattern := range models {
+			if !isModelPattern(pattern) || len(pattern) <= len(found) {
+				continue
+			}
+			if ok, _ := path.Match(pattern, name); ok {
+				found = pattern
+			}
+		}
+		if found != "" {
+			return models[found], true
+		}
+	}
+	return ModelInfo{}, false
+}
+
+// ModelInfo returns what is known about the model, the `models` in the config take precedence over the built-in
+// registry, and their unset fields are inherited.
+func (c *GlobalConfig) ModelInfo(model string) ModelInfo {
+	info, _ := lookupModel(builtinModels, model)
+	if override, ok := lookupModel(c.Models, model); ok {
+		info = info.merge(override)
+	}
+	if info.Features == nil {
+		info.Features = slices.DeleteFunc(
+			slices.Clone(modelFeatures), func(f string) bool {
+				return f == FeatureDeveloper || f == FeatureReasoning
+			},
+		)
+	}
+	return info
+}
+
+// isKnownModel reports whether the model is in the built-in registry or the `models` of the config.
+func (c *GlobalConfig) isKnownModel(model string) bool {
+	_, builtin := lookupModel(builtinModels, model)
+	_, configured := lookupModel(c.Models, model)
+	return builtin || configured
+}
+
+// KnownModels returns the well-known models, along with the models mentioned in the config.
+func KnownModels(conf GlobalConfig) []string {
+	seen := map[string]bool{}
+	var models []string
+	add := func(m string) {
+		if m != "" && !seen[m] {
+			seen[m] = true
+			models = append(models, m)
+		}
+	}
+	for _, m := range knownModels {
+		add(m)
+	}
+	add(conf.Conversation.Model)
+	for m := range conf.ModelMapping {
+		add(m)
+	}
+	for m := range conf.Models {
+		if !isModelPattern(m) {
+			add(m)
+		}
+	}
+	sort.Strings(models)
+	return models
+}
+
+// shapeRequest adapts the request to the features and limits of the model.
+func (m ModelInfo) shapeRequest(req *openai.ChatCompletionRequest) {
+	if !m.Supports(FeatureStreaming) {
+		req.Stream = false
+	}
+	if !m.Supports(FeatureTemperature) {
+		req.Temperature = 0
+	}
+	if !m.Supports(FeatureTools) {
+		req.Tools = nil
+	}
+	if m.MaxOutputTokens > 0 && req.MaxTokens > m.MaxOutputTokens {
+		req.MaxTokens = m.MaxOutputTokens
+	}
+	if m.Supports(FeatureReasoning) {
+		req.MaxCompletionTokens, req.MaxTokens = req.MaxTokens, 0
+	}
+
+	messages := make([]openai.ChatCompletionMessage, 0, len(req.Messages))
+	for _, msg := range req.Messages {
+		if msg.Role == openai.ChatMessageRoleSystem {
+			switch {
+			case m.Supports(FeatureDeveloper):
+				msg.Role = openai.ChatMessageRoleDeveloper
+			case !m.Supports(FeatureSystem):
+				msg.Role = openai.ChatMessageRoleUser
+			}
+		}
+		if !m.Supports(FeatureVision) && len(msg.MultiContent) > 0 {
+			msg.MultiContent = slices.DeleteFunc(
+				slices.Clone(msg.MultiContent), func(part openai.ChatMessagePart) bool {
+					return part.Type == openai.ChatMessagePartTypeImageURL
+				},
+			)
+		}
+		messages = append(messages, msg)
+	}
+	req.Messages = messages
+}
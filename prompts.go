@@ -0,0 +1,185 @@
+package chatgpt
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"text/template"
+	"text/template/parse"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Prompt is a prompt template loaded from the prompts directory.
+type Prompt struct {
+	Name        string `yaml:"name"`
+	Description string `yaml:"description"`
+	// Model and Temperature are the defaults of new conversations using the prompt.
+	Model       string   `yaml:"model"`
+	Temperature *float32 `yaml:"temperature"`
+	Text        string   `yaml:"-"`
+	Path        string   `yaml:"-"`
+}
+
+// PromptsDir returns the directory of the prompt files.
+func PromptsDir() string {
+	return filepath.Join(configDir(), "prompts")
+}
+
+// loadPrompts reads the *.md files in dir by name. The name defaults to the file name without extension.
+func loadPrompts(dir string) (map[string]Prompt, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.md"))
+	if err != nil {
+		return nil, err
+	}
+	prompts := make(map[string]Prompt, len(paths))
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read prompt: %w", err)
+		}
+		p, err := parsePrompt(data)
+		if err != nil {
+			return nil, fmt.Errorf("invalid prompt %s: %w", path, err)
+		}
+		p.Path = path
+		if p.Name == "" {
+			p.Name = strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+		}
+		prompts[p.Name] = p
+	}
+	return prompts, nil
+}
+
+// parsePrompt parses a prompt file, which may start with a YAML front-matter between `---` lines.
+func parsePrompt(data []byte) (Prompt, error) {
+	var p Prompt
+	text := strings.ReplaceAll(string(data), "\r\n", "\n")
+	if rest, ok := strings.CutPrefix(text, "---\n"); ok {
+		header, body, found := strings.Cut(rest, "\n---")
+		if !found {
+			return p, errors.New("front-matter is not closed by ---")
+		}
+		if err := yaml.Unmarshal([]byte(header), &p); err != nil {
+			return p, err
+		}
+		text = body
+	}
+	p.Text = strings.TrimSpace(text)
+	if _, err := template.New("").Parse(p.Text); err != nil {
+		return p, err
+	}
+	return p, nil
+}
+
+// builtinPromptVars are the template variables available to all prompts.
+func builtinPromptVars() map[string]string {
+	cwd, _ := os.Getwd()
+	return map[string]string{
+		"date": time.Now().Format(time.DateOnly),
+		"cwd":  cwd,
+		"os":   runtime.GOOS,
+	}
+}
+
+// renderPrompt executes the prompt as a template, variables not given are empty.
+func renderPrompt(text string, vars map[string]string) (string, error) {
+	if !strings.Contains(text, "{{") {
+		return text, nil
+	}
+	tmpl, err := template.New("").Option("missingkey=zero").Parse(text)
+	if err != nil {
+		return "", err
+	}
+	data := builtinPromptVars()
+	for k, v := range vars {
+		data[k] = v
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// promptVariables returns the names of the variables printed by the template, e.g. "lang" for `{{.lang}}`.
+// Variables only used as conditions, like `{{if .strict}}`, are optional and not returned.
+func promptVariables(text string) []string {
+	if !strings.Contains(text, "{{") {
+		return nil
+	}
+	tmpl, err := template.New("").Parse(text)
+	if err != nil || tmpl.Tree == nil {
+		return nil
+	}
+	var names []string
+	var walk func(n parse.Node)
+	walk = func(n parse.Node) {
+		switch n := n.(type) {
+		case *parse.ListNode:
+			if n == nil {
+				return
+			}
+			for _, child := range n.Nodes {
+				walk(child)
+			}
+		case *parse.ActionNode:
+			for _, cmd := range n.Pipe.Cmds {
+				for _, arg := range cmd.Args {
+					walk(arg)
+				}
+			}
+		case *parse.FieldNode:
+			if !slices.Contains(names, n.Ident[0]) {
+				names = append(names, n.Ident[0])
+			}
+		case *parse.IfNode:
+			walk(n.List)
+			walk(n.ElseList)
+		case *parse.RangeNode:
+			walk(n.List)
+			walk(n.ElseList)
+		case *parse.WithNode:
+			walk(n.List)
+			walk(n.ElseList)
+		}
+	}
+	walk(tmpl.Tree.Root)
+	return names
+}
+
+// MissingPromptVars returns the variables used by the prompt that are neither built-in nor set in PromptVars.
+func (c *GlobalConfig) MissingPromptVars(key string) []string {
+	builtin := builtinPromptVars()
+	var missing []string
+	for _, name := range promptVariables(c.promptText(key)) {
+		if _, ok := builtin[name]; ok {
+			continue
+		}
+		if _, ok := c.PromptVars[name]; !ok {
+			missing = append(missing, name)
+		}
+	}
+	return missing
+}
+
+// withPromptDefaults applies the default model and temperature of the prompt.
+func (c *GlobalConfig) withPromptDefaults(conf ConversationConfig) ConversationConfig {
+	p, ok := c.PromptLibrary[conf.Prompt]
+	if !ok {
+		return conf
+	}
+	if p.Model != "" {
+		conf.Model = p.Model
+	}
+	if p.Temperature != nil {
+		conf.Temperature = *p.Temperature
+	}
+	return conf
+}
@@ -0,0 +1,253 @@
+package chatgpt
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// RetryConfig configures how failed requests are retried. Only rate limited, server and network errors are retried.
+type RetryConfig struct {
+	// MaxAttempts is the number of attempts including the first one, 1 disables retrying.
+	MaxAttempts  int      `json:"max_attempts"`
+	InitialDelay Duration `json:"initial_delay"`
+	MaxDelay     Duration `json:"max_delay"`
+}
+
+// delay returns how long to wait after the given failed attempt, the server's requested wait takes precedence
+// when it's longer.
+func (c RetryConfig) delay(attempt int, requested time.Duration) time.Duration {
+	d := float64(c.InitialDelay) * math.Pow(2, float64(attempt-1))
+	if max := float64(c.MaxDelay); max > 0 && d > max {
+		d = max
+	}
+	// Equal jitter: half of the delay is fixed, the other half is random.
+	delay := time.Duration(d/2 + rand.Float64()*d/2)
+	if requested > delay {
+		delay = requested
+	}
+	return delay
+}
+
+// RetryEvent is reported before a failed request is retried.
+type RetryEvent struct {
+	Attempt     int // the upcoming attempt
+	MaxAttempts int
+	Delay       time.Duration
+	Err         error
+}
+
+func (e RetryEvent) String() string {
+	return fmt.Sprintf("retrying in %ds (attempt %d/%d)", int(math.Ceil(e.Delay.Seconds())), e.Attempt, e.MaxAttempts)
+}
+
+// isRetryable reports whether the request failed for a transient reason: rate limiting, server errors or network errors.
+// Running out of quota is also reported as 429, but waiting doesn't help.
+func isRetryable(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) {
+		return false
+	}
+	var (
+		apiErr *openai.APIError
+		reqErr *openai.RequestError
+		netErr net.Error
+	)
+	switch {
+	case errors.As(err, &apiErr):
+		return isRetryableStatus(apiErr.HTTPStatusCode) && apiErr.Code != "insufficient_quota" &&
+			apiErr.Type != "insufficient_quota"
+	case errors.As(err, &reqErr):
+		return isRetryableStatus(reqErr.HTTPStatusCode) && !strings.Contains(string(reqErr.Body), "insufficient_quota")
+	case errors.As(err, &netErr):
+		return true
+	case errors.Is(err, io.ErrUnexpectedEOF):
+		return true
+	}
+	return false
+}
+
+func isRetryableStatus(code int) bool {
+	return code == http.StatusTooManyRequests || code == http.StatusRequestTimeout || code >= 500
+}
+
+type rateLimitKey struct{}
+
+// rateLimit holds how long the server asked to wait before retrying a request.
+type rateLimit struct {
+	mu   sync.Mutex
+	wait time.Duration
+}
+
+// rateLimitDoer records the wait requested by the headers of failed responses into the request's context,
+// since go-openai errors don't carry the response headers.
+type rateLimitDoer struct {
+	doer openai.HTTPDoer
+}
+
+func (d rateLimitDoer) Do(req *http.Request) (*http.Response, error) {
+	resp, err := d.doer.Do(req)
+	if err != nil || resp.StatusCode < http.StatusBadRequest {
+		return resp, err
+	}
+	if rl, ok := req.Context().Value(rateLimitKey{}).(*rateLimit); ok {
+		rl.mu.Lock()
+		rl.wait = retryAfter(resp.Header, time.Now())
+		rl.mu.Unlock()
+	}
+	return resp, nil
+}
+
+// retryAfter parses the Retry-After headers, falling back to the reset time of exhausted x-ratelimit-* limits.
+func retryAfter(h http.Header, now time.Time) time.Duration {
+	if v := h.Get("Retry-After-Ms"); v != "" {
+		if ms, err := strconv.ParseFloat(v, 64); err == nil {
+			return time.Duration(ms * float64(time.Millisecond))
+		}
+	}
+	if v := h.Get("Retry-After"); v != "" {
+		if secs, err := strconv.ParseFloat(v, 64); err == nil {
+			return time.Duration(secs * float64(time.Second))
+		}
+		if t, err := http.ParseTime(v); err == nil {
+			return t.Sub(now)
+		}
+	}
+	var wait time.Duration
+	for _, limit := range []string{"requests", "tokens"} {
+		if strings.TrimSpace(h.Get("X-Ratelimit-Remaining-"+limit)) != "0" {
+			continue
+		}
+		// The reset time looks like "1s", "6m0s" or "20ms".
+		if d, err := time.ParseDuration(h.Get("X-Ratelimit-Reset-" + limit)); err == nil && d > wait {
+			wait = d
+		}
+	}
+	return wait
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// withRetry calls fn until it succeeds, fails with an error that is not transient, or runs out of attempts.
+func (c *ChatGPT) withRetry(ctx context.Context, onRetry func(RetryEvent), fn func(ctx context.Context) error) error {
+	policy := c.config().Retry
+	for attempt := 1; ; attempt++ {
+		rl := &rateLimit{}
+		err := fn(context.WithValue(ctx, rateLimitKey{}, rl))
+		if err == nil || attempt >= policy.MaxAttempts || !isRetryable(err) {
+			return err
+		}
+		rl.mu.Lock()
+		delay := policy.delay(attempt, rl.wait)
+		rl.mu.Unlock()
+		if onRetry != nil {
+			onRetry(RetryEvent{Attempt: attempt + 1, MaxAttempts: policy.MaxAttempts, Delay: delay, Err: err})
+		}
+		if err := sleep(ctx, delay); err != nil {
+			return err
+		}
+	}
+}
+
+// resumableStream reads a completion stream, and reopens it to continue the answer when it breaks midway.
+// The partial answer is sent back as an assistant message, so the model picks up where it stopped.
+type resumableStream struct {
+	c            *ChatGPT
+	client       *openai.Client
+	ctx          context.Context
+	req          openai.ChatCompletionRequest
+	onRetry      func(RetryEvent)
+	stream       *openai.ChatCompletionStream
+	content      strings.Builder
+	hasToolCalls bool
+	resumes      int
+}
+
+func (c *ChatGPT) openStream(
+	ctx context.Context,
+	client *openai.Client,
+	req openai.ChatCompletionRequest,
+	onRetry func(RetryEvent),
+) (*resumableStream, error) {
+	s := &resumableStream{c: c, client: client, ctx: ctx, req: req, onRetry: onRetry}
+	if err := s.open(req); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *resumableStream) open(req openai.ChatCompletionRequest) error {
+	return s.c.withRetry(
+		s.ctx, s.onRetry, func(ctx context.Context) error {
+			stream, err := s.client.CreateChatCompletionStream(ctx, req)
+			if err != nil {
+				return err
+			}
+			s.stream = stream
+			return nil
+		},
+	)
+}
+
+func (s *resumableStream) Recv() (openai.ChatCompletionStreamResponse, error) {
+	for {
+		resp, err := s.stream.Recv()
+		if err == nil {
+			if len(resp.Choices) > 0 {
+				s.content.WriteString(resp.Choices[0].Delta.Content)
+				if len(resp.Choices[0].Delta.ToolCalls) > 0 {
+					s.hasToolCalls = true
+				}
+			}
+			return resp, nil
+		}
+		// Partial tool calls can't be continued.
+		policy := s.c.config().Retry
+		if errors.Is(err, io.EOF) || s.hasToolCalls || s.resumes+1 >= policy.MaxAttempts || !isRetryable(err) {
+			return resp, err
+		}
+		s.resumes++
+		delay := policy.delay(s.resumes, 0)
+		if s.onRetry != nil {
+			s.onRetry(RetryEvent{Attempt: s.resumes + 1, MaxAttempts: policy.MaxAttempts, Delay: delay, Err: err})
+		}
+		if err := sleep(s.ctx, delay); err != nil {
+			return resp, err
+		}
+		s.stream.Close()
+		req := s.req
+		if s.content.Len() > 0 {
+			req.Messages = append(
+				slices.Clone(req.Messages),
+				openai.ChatCompletionMessage{Role: openai.ChatMessageRoleAssistant, Content: s.content.String()},
+			)
+		}
+		if err := s.open(req); err != nil {
+			return resp, err
+		}
+	}
+}
+
+func (s *resumableStream) Close() {
+	s.stream.Close()
+}
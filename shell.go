@@ -0,0 +1,62 @@
+package chatgpt
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+const shellCommandPrompt = "You are a command line assistant on %s, using %s. " +
+	"Reply with a one-line command that performs the task described by the user. " +
+	"Put the command alone on the first line, without code fences or any other text. " +
+	"On the second line, explain briefly what the command does."
+
+// Shell returns the user's shell and the flag to run a command with it.
+func Shell() (string, string) {
+	if runtime.GOOS == "windows" {
+		if sh := os.Getenv("COMSPEC"); sh != "" {
+			return sh, "/C"
+		}
+		return "cmd.exe", "/C"
+	}
+	if sh := os.Getenv("SHELL"); sh != "" {
+		return sh, "-c"
+	}
+	return "/bin/sh", "-c"
+}
+
+// ShellCommandMessages builds the messages to ask for a shell command performing the task.
+func ShellCommandMessages(task string) []openai.ChatCompletionMessage {
+	sh, _ := Shell()
+	return []openai.ChatCompletionMessage{
+		{
+			Role:    openai.ChatMessageRoleSystem,
+			Content: fmt.Sprintf(shellCommandPrompt, runtime.GOOS, filepath.Base(sh)),
+		},
+		{Role: openai.ChatMessageRoleUser, Content: task},
+	}
+}
+
+// ParseShellCommand splits the answer into the command and its explanation, code fences are stripped.
+func ParseShellCommand(answer string) (command, explanation string) {
+	var lines []string
+	for _, line := range strings.Split(answer, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "```") {
+			continue
+		}
+		lines = append(lines, line)
+	}
+	if len(lines) == 0 {
+		return "", ""
+	}
+	command = strings.Trim(lines[0], "`")
+	command = strings.TrimPrefix(command, "$ ")
+	explanation = strings.Join(lines[1:], " ")
+	explanation = strings.TrimSpace(strings.TrimLeft(explanation, "#"))
+	return command, explanation
+}
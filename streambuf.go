@@ -0,0 +1,77 @@
+package chatgpt
+
+import (
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// streamBuffer collects the streamed answer in the background, so the network is read independently of how often
+// the answer is rendered. The tool calls are collected too, the buffer is owned by a single answer.
+type streamBuffer struct {
+	mu        sync.Mutex
+	content   strings.Builder
+	toolCalls []openai.ToolCall
+	err       error // io.EOF when the stream is done
+	ready     chan struct{}
+	done      chan struct{} // closed when the reader exits
+}
+
+func newStreamBuffer(toolCalls []openai.ToolCall) *streamBuffer {
+	return &streamBuffer{toolCalls: toolCalls, ready: make(chan struct{}, 1), done: make(chan struct{})}
+}
+
+func (b *streamBuffer) notify() {
+	select {
+	case b.ready <- struct{}{}:
+	default:
+	}
+}
+
+// read receives the stream until it fails, ends or its context is canceled, then closes it.
+func (b *streamBuffer) read(stream *resumableStream) {
+	defer close(b.done)
+	defer stream.Close()
+	for {
+		resp, err := stream.Recv()
+		b.mu.Lock()
+		if err != nil {
+			b.err = err
+			b.mu.Unlock()
+			b.notify()
+			return
+		}
+		if len(resp.Choices) > 0 {
+			b.content.WriteString(resp.Choices[0].Delta.Content)
+			b.toolCalls = mergeToolCalls(b.toolCalls, resp.Choices[0].Delta.ToolCalls)
+		}
+		b.mu.Unlock()
+		b.notify()
+	}
+}
+
+// next waits for the content received since the last call, the error is returned after all the content.
+func (b *streamBuffer) next() (string, error) {
+	for {
+		b.mu.Lock()
+		content, err := b.content.String(), b.err
+		b.content.Reset()
+		b.mu.Unlock()
+		if content != "" {
+			return content, nil
+		}
+		if err != nil {
+			return "", err
+		}
+		<-b.ready
+	}
+}
+
+// calls returns the tool calls received so far, they are complete once next returns an error.
+func (b *streamBuffer) calls() []openai.ToolCall {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return slices.Clone(b.toolCalls)
+}
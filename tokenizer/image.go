@@ -0,0 +1,76 @@
+package tokenizer
+
+import (
+	"encoding/base64"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"math"
+	"strings"
+
+	"github.com/sashabaranov/go-openai"
+	_ "golang.org/x/image/webp"
+)
+
+// imageCost is the cost of an image in tokens: a base cost, plus the cost of each 512px tile in high detail mode.
+type imageCost struct {
+	base int
+	tile int
+}
+
+var (
+	defaultImageCost = imageCost{base: 85, tile: 170}
+	miniImageCost    = imageCost{base: 2833, tile: 5667}
+)
+
+func imageCostFor(model string) imageCost {
+	if strings.HasPrefix(model[strings.LastIndex(model, "/")+1:], "gpt-4o-mini") {
+		return miniImageCost
+	}
+	return defaultImageCost
+}
+
+// imageTokens counts an image part with the formula in https://platform.openai.com/docs/guides/vision#calculating-costs.
+// Images that are not data URLs are assumed to be 1024x1024.
+func imageTokens(model string, img *openai.ChatMessageImageURL) int {
+	if img == nil {
+		return 0
+	}
+	cost := imageCostFor(model)
+	if img.Detail == openai.ImageURLDetailLow {
+		return cost.base
+	}
+	width, height, ok := imageSize(img.URL)
+	if !ok {
+		width, height = 1024, 1024
+	}
+	// The image is scaled to fit in 2048x2048, then its shortest side is scaled down to 768px.
+	w, h := float64(width), float64(height)
+	if longest := max(w, h); longest > 2048 {
+		w, h = w*2048/longest, h*2048/longest
+	}
+	if shortest := min(w, h); shortest > 768 {
+		w, h = w*768/shortest, h*768/shortest
+	}
+	tiles := int(math.Ceil(w/512) * math.Ceil(h/512))
+	return cost.base + tiles*cost.tile
+}
+
+// CountImageTokens counts an image sent in auto detail mode, like the images attached to questions.
+func CountImageTokens(model, url string) int {
+	return imageTokens(model, &openai.ChatMessageImageURL{URL: url, Detail: openai.ImageURLDetailAuto})
+}
+
+// imageSize reads the size of an image in a base64 data URL.
+func imageSize(url string) (width, height int, ok bool) {
+	header, data, found := strings.Cut(url, ",")
+	if !found || !strings.HasPrefix(header, "data:") || !strings.HasSuffix(header, ";base64") {
+		return 0, 0, false
+	}
+	conf, _, err := image.DecodeConfig(base64.NewDecoder(base64.StdEncoding, strings.NewReader(data)))
+	if err != nil || conf.Width == 0 || conf.Height == 0 {
+		return 0, 0, false
+	}
+	return conf.Width, conf.Height, true
+}
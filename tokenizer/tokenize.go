@@ -1,32 +1,85 @@
 package tokenizer
 
 import (
+	"encoding/json"
+	"fmt"
 	"strings"
+	"sync"
 
 	"github.com/pkoukk/tiktoken-go"
 	tiktokenloader "github.com/pkoukk/tiktoken-go-loader"
 	"github.com/sashabaranov/go-openai"
 )
 
-var encodings = map[string]*tiktoken.Tiktoken{}
+var (
+	encodingsMu sync.Mutex
+	// encodings loads each encoding once by name, since loading takes a while.
+	encodings = map[string]func() (*tiktoken.Tiktoken, error){}
+)
+
+// modelEncodings maps model name prefixes to encodings, more specific prefixes come first.
+var modelEncodings = []struct {
+	prefix   string
+	encoding string
+}{
+	{"gpt-4o", tiktoken.MODEL_O200K_BASE},
+	{"chatgpt-4o", tiktoken.MODEL_O200K_BASE},
+	{"gpt-4.1", tiktoken.MODEL_O200K_BASE},
+	{"gpt-4.5", tiktoken.MODEL_O200K_BASE},
+	{"gpt-5", tiktoken.MODEL_O200K_BASE},
+	{"o1", tiktoken.MODEL_O200K_BASE},
+	{"o3", tiktoken.MODEL_O200K_BASE},
+	{"o4", tiktoken.MODEL_O200K_BASE},
+	{"gpt-4", tiktoken.MODEL_CL100K_BASE},
+	{"gpt-3.5-turbo", tiktoken.MODEL_CL100K_BASE},
+	{"gpt-35-turbo", tiktoken.MODEL_CL100K_BASE}, // Azure deployment names
+	{"text-embedding-3", tiktoken.MODEL_CL100K_BASE},
+	{"text-embedding-ada-002", tiktoken.MODEL_CL100K_BASE},
+}
+
+// estimateEncoding is used to estimate the tokens of models with an unknown tokenizer.
+const estimateEncoding = tiktoken.MODEL_O200K_BASE
 
 func init() {
 	tiktoken.SetBpeLoader(tiktokenloader.NewOfflineLoader())
 }
 
+// encodingName returns the encoding of the model, and whether it's known.
+func encodingName(model string) (string, bool) {
+	// Strip the provider of names like "openai/gpt-4o".
+	model = model[strings.LastIndex(model, "/")+1:]
+	for _, e := range modelEncodings {
+		if strings.HasPrefix(model, e.prefix) {
+			return e.encoding, true
+		}
+	}
+	return estimateEncoding, false
+}
+
+// Estimated reports whether the token counts of the model are estimates, because its tokenizer is unknown.
+func Estimated(model string) bool {
+	_, ok := encodingName(model)
+	return !ok
+}
+
+// getEncoding is safe for concurrent use, callers wanting an encoding that is being loaded wait for it.
 func getEncoding(model string) (*tiktoken.Tiktoken, error) {
-	enc, ok := encodings[model]
+	name, _ := encodingName(model)
+	encodingsMu.Lock()
+	load, ok := encodings[name]
 	if !ok {
-		var err error
-		enc, err = tiktoken.EncodingForModel(model)
-		if err != nil {
-			return nil, err
-		}
-		encodings[model] = enc
+		load = sync.OnceValues(
+			func() (*tiktoken.Tiktoken, error) {
+				return tiktoken.GetEncoding(name)
+			},
+		)
+		encodings[name] = load
 	}
-	return enc, nil
+	encodingsMu.Unlock()
+	return load()
 }
 
+// CountTokens counts the tokens of text, the count is estimated for unknown models.
 func CountTokens(model, text string) int {
 	enc, err := getEncoding(model)
 	if err != nil {
@@ -37,41 +90,38 @@ func CountTokens(model, text string) int {
 }
 
 // CountMessagesTokens based on https://github.com/openai/openai-cookbook/blob/main/examples/How_to_count_tokens_with_tiktoken.ipynb
+// The count is estimated for unknown models.
 func CountMessagesTokens(model string, messages []openai.ChatCompletionMessage) int {
 	enc, err := getEncoding(model)
 	if err != nil {
 		return 0
 	}
+	return countMessages(enc, model, messages)
+}
 
-	var (
-		tokens           int
-		tokensPerMessage int
-		tokensPerName    int
-	)
+// CountRequestTokens counts the prompt tokens of a request, including the tool definitions.
+// The count is estimated for unknown models.
+func CountRequestTokens(req openai.ChatCompletionRequest) int {
+	enc, err := getEncoding(req.Model)
+	if err != nil {
+		return 0
+	}
+	functions := make([]openai.FunctionDefinition, 0, len(req.Tools)+len(req.Functions))
+	for _, tool := range req.Tools {
+		if tool.Function != nil {
+			functions = append(functions, *tool.Function)
+		}
+	}
+	functions = append(functions, req.Functions...)
+	return countMessages(enc, req.Model, req.Messages) + countFunctions(enc, req.Model, functions)
+}
 
-	switch model {
-	case "gpt-3.5-turbo-0613",
-		"gpt-3.5-turbo-16k-0613",
-		"gpt-4-0314",
-		"gpt-4-32k-0314",
-		"gpt-4-0613",
-		"gpt-4-32k-0613":
-		tokensPerMessage = 3
-		tokensPerName = 1
-	case "gpt-3.5-turbo-0301":
+func countMessages(enc *tiktoken.Tiktoken, model string, messages []openai.ChatCompletionMessage) int {
+	var tokens int
+	tokensPerMessage, tokensPerName := 3, 1
+	if model == "gpt-3.5-turbo-0301" {
 		tokensPerMessage = 4 // every message follows <|start|>{role/name}\n{content}<|end|>\n
 		tokensPerName = -1   // if there's a name, the role is omitted
-	default:
-		switch {
-		case strings.Contains(model, "gpt-3.5-turbo"):
-			// gpt-3.5-turbo may update over time. Returning num tokens assuming gpt-3.5-turbo-0613.
-			return CountMessagesTokens("gpt-3.5-turbo-0613", messages)
-		case strings.Contains(model, "gpt-4"):
-			// gpt-4 may update over time. Returning num tokens assuming gpt-4-0613.
-			return CountMessagesTokens("gpt-4-0613", messages)
-		default:
-			return 0
-		}
 	}
 
 	for k := range messages {
@@ -79,13 +129,85 @@ func CountMessagesTokens(model string, messages []openai.ChatCompletionMessage)
 
 		tokens += len(enc.Encode(messages[k].Role, nil, nil))
 		tokens += len(enc.Encode(messages[k].Content, nil, nil))
+		for _, part := range messages[k].MultiContent {
+			switch part.Type {
+			case openai.ChatMessagePartTypeText:
+				tokens += len(enc.Encode(part.Text, nil, nil))
+			case openai.ChatMessagePartTypeImageURL:
+				tokens += imageTokens(model, part.ImageURL)
+			}
+		}
 		tokens += len(enc.Encode(messages[k].Name, nil, nil))
 		if messages[k].Name != "" {
 			tokens += tokensPerName
 		}
+		// Calls are formatted like the function name followed by the JSON arguments.
+		for _, call := range messages[k].ToolCalls {
+			tokens += tokensPerMessage
+			tokens += len(enc.Encode(call.Function.Name, nil, nil))
+			tokens += len(enc.Encode(call.Function.Arguments, nil, nil))
+		}
+		if call := messages[k].FunctionCall; call != nil {
+			tokens += tokensPerMessage
+			tokens += len(enc.Encode(call.Name, nil, nil))
+			tokens += len(enc.Encode(call.Arguments, nil, nil))
+		}
 	}
 
 	tokens += 3 // every reply is primed with <|start|>assistant<|message|>
 
 	return tokens
 }
+
+// countFunctions counts the tool definitions, based on
+// https://github.com/openai/openai-cookbook/blob/main/examples/How_to_count_tokens_with_tiktoken.ipynb
+func countFunctions(enc *tiktoken.Tiktoken, model string, functions []openai.FunctionDefinition) int {
+	if len(functions) == 0 {
+		return 0
+	}
+	const (
+		propInit = 3
+		propKey  = 3
+		enumInit = -3
+		enumItem = 3
+		funcEnd  = 12
+	)
+	funcInit := 7
+	if name, _ := encodingName(model); name == tiktoken.MODEL_CL100K_BASE {
+		funcInit = 10
+	}
+
+	tokens := funcEnd
+	for _, f := range functions {
+		tokens += funcInit
+		tokens += len(enc.Encode(f.Name+":"+strings.TrimSuffix(f.Description, "."), nil, nil))
+
+		var params struct {
+			Properties map[string]struct {
+				Type        any    `json:"type"`
+				Description string `json:"description"`
+				Enum        []any  `json:"enum"`
+			} `json:"properties"`
+		}
+		if data, err := json.Marshal(f.Parameters); err == nil {
+			_ = json.Unmarshal(data, &params)
+		}
+		if len(params.Properties) == 0 {
+			continue
+		}
+		tokens += propInit
+		for name, p := range params.Properties {
+			tokens += propKey
+			if len(p.Enum) > 0 {
+				tokens += enumInit
+				for _, item := range p.Enum {
+					tokens += enumItem
+					tokens += len(enc.Encode(fmt.Sprint(item), nil, nil))
+				}
+			}
+			line := fmt.Sprintf("%s:%v:%s", name, p.Type, strings.TrimSuffix(p.Description, "."))
+			tokens += len(enc.Encode(line, nil, nil))
+		}
+	}
+	return tokens
+}
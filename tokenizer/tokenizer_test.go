@@ -0,0 +1,72 @@
+package tokenizer
+
+import (
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/pkoukk/tiktoken-go"
+)
+
+func TestCountTokens(t *testing.T) {
+	tests := []struct {
+		model string
+		text  string
+		want  int
+	}{
+		{"gpt-3.5-turbo", "Hello, world!", 4},
+		{"gpt-4o", "Hello, world!", 4},
+		{"openai/gpt-4o-mini", "Hello, world!", 4},
+		{"gpt-4", "", 0},
+	}
+	for _, tt := range tests {
+		if got := CountTokens(tt.model, tt.text); got != tt.want {
+			t.Errorf("CountTokens(%q, %q) = %d, want %d", tt.model, tt.text, got, tt.want)
+		}
+	}
+}
+
+// TestCountTokensConcurrent counts with the encodings still unloaded, run it with -race.
+func TestCountTokensConcurrent(t *testing.T) {
+	// Other tests have loaded the encodings already.
+	encodingsMu.Lock()
+	encodings = map[string]func() (*tiktoken.Tiktoken, error){}
+	encodingsMu.Unlock()
+
+	models := []string{"gpt-4o", "gpt-3.5-turbo", "unknown-model", "gpt-4.1"}
+	text := strings.Repeat("The quick brown fox jumps over the lazy dog. ", 20)
+
+	var wg sync.WaitGroup
+	counts := make([]int, 8*len(models))
+	for i := range counts {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			counts[i] = CountTokens(models[i%len(models)], text)
+		}()
+	}
+	wg.Wait()
+
+	for i, n := range counts {
+		model := models[i%len(models)]
+		if want := CountTokens(model, text); n == 0 || n != want {
+			t.Errorf("concurrent CountTokens(%q) = %d, want %d", model, n, want)
+		}
+	}
+}
+
+func BenchmarkCountTokens(b *testing.B) {
+	text := strings.Repeat("The quick brown fox jumps over the lazy dog. ", 100)
+	for _, model := range []string{"gpt-4o", "gpt-3.5-turbo"} {
+		b.Run(
+			model, func(b *testing.B) {
+				CountTokens(model, "") // load the encoding
+				b.SetBytes(int64(len(text)))
+				b.ResetTimer()
+				for i := 0; i < b.N; i++ {
+					CountTokens(model, text)
+				}
+			},
+		)
+	}
+}
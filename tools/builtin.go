@@ -0,0 +1,270 @@
+package tools
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+const (
+	// maxReadBytes leaves room for the offset hint in a result of MaxResultLength, so the hint isn't truncated.
+	maxReadBytes   = MaxResultLength - 128
+	maxGrepResults = 100
+)
+
+// Builtin returns a registry with the built-in tools.
+func Builtin() *Registry {
+	r := NewRegistry()
+	r.Register(readFile)
+	r.Register(listDir)
+	r.Register(grep)
+	r.Register(currentTime)
+	return r
+}
+
+// workDirPath checks that the path is in the working directory once symlinks are resolved, so that the model can't
+// read files like ~/.ssh/id_rsa without the user knowing.
+func workDirPath(path string) error {
+	wd, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+	wd, err = filepath.EvalSymlinks(wd)
+	if err != nil {
+		return err
+	}
+	abs := path
+	if !filepath.IsAbs(abs) {
+		abs = filepath.Join(wd, abs)
+	}
+	resolved, err := filepath.EvalSymlinks(abs)
+	if err != nil {
+		return err
+	}
+	rel, err := filepath.Rel(wd, resolved)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return fmt.Errorf("%s is outside the working directory", path)
+	}
+	return nil
+}
+
+func parseArgs(args json.RawMessage, v any) error {
+	if err := json.Unmarshal(args, v); err != nil {
+		return fmt.Errorf("invalid arguments: %w", err)
+	}
+	return nil
+}
+
+var readFile = Tool{
+	Name:        "read_file",
+	Description: "Read the content of a text file in the working directory.",
+	Parameters: json.RawMessage(`{
+  "type": "object",
+  "properties": {
+    "path": {"type": "string", "description": "Path of the file"},
+    "offset": {"type": "integer", "description": "Byte offset to start reading from"}
+  },
+  "required": ["path"]
+}`),
+	Run: func(ctx context.Context, args json.RawMessage) (string, error) {
+		var p struct {
+			Path   string `json:"path"`
+			Offset int64  `json:"offset"`
+		}
+		if err := parseArgs(args, &p); err != nil {
+			return "", err
+		}
+		if err := workDirPath(p.Path); err != nil {
+			return "", err
+		}
+		f, err := os.Open(p.Path)
+		if err != nil {
+			return "", err
+		}
+		defer func() { _ = f.Close() }()
+		if p.Offset > 0 {
+			if _, err := f.Seek(p.Offset, io.SeekStart); err != nil {
+				return "", err
+			}
+		}
+		data, err := io.ReadAll(io.LimitReader(f, maxReadBytes+1))
+		if err != nil {
+			return "", err
+		}
+		if len(data) > maxReadBytes {
+			content := truncate(string(data), maxReadBytes)
+			return fmt.Sprintf(
+				"%s\n... (file truncated, continue with offset %d)",
+				content,
+				p.Offset+int64(len(content)),
+			), nil
+		}
+		return string(data), nil
+	},
+}
+
+var listDir = Tool{
+	Name:        "list_dir",
+	Description: "List entries of a directory in the working directory. Directories are suffixed with a slash.",
+	Parameters: json.RawMessage(`{
+  "type": "object",
+  "properties": {
+    "path": {"type": "string", "description": "Path of the directory, defaults to the current directory"}
+  }
+}`),
+	Run: func(ctx context.Context, args json.RawMessage) (string, error) {
+		var p struct {
+			Path string `json:"path"`
+		}
+		if err := parseArgs(args, &p); err != nil {
+			return "", err
+		}
+		if p.Path == "" {
+			p.Path = "."
+		}
+		if err := workDirPath(p.Path); err != nil {
+			return "", err
+		}
+		entries, err := os.ReadDir(p.Path)
+		if err != nil {
+			return "", err
+		}
+		var sb strings.Builder
+		for _, e := range entries {
+			sb.WriteString(e.Name())
+			if e.IsDir() {
+				sb.WriteString("/")
+			}
+			sb.WriteString("\n")
+		}
+		return sb.String(), nil
+	},
+}
+
+var errTooManyResults = errors.New("too many results")
+
+var grep = Tool{
+	Name:        "grep",
+	Description: "Search files under a directory of the working directory for lines matching a regular expression (RE2 syntax).",
+	Parameters: json.RawMessage(`{
+  "type": "object",
+  "properties": {
+    "pattern": {"type": "string", "description": "Regular expression to search for"},
+    "path": {"type": "string", "description": "File or directory to search in, defaults to the current directory"}
+  },
+  "required": ["pattern"]
+}`),
+	Run: func(ctx context.Context, args json.RawMessage) (string, error) {
+		var p struct {
+			Pattern string `json:"pattern"`
+			Path    string `json:"path"`
+		}
+		if err := parseArgs(args, &p); err != nil {
+			return "", err
+		}
+		if p.Path == "" {
+			p.Path = "."
+		}
+		if err := workDirPath(p.Path); err != nil {
+			return "", err
+		}
+		re, err := regexp.Compile(p.Pattern)
+		if err != nil {
+			return "", err
+		}
+
+		var (
+			sb    strings.Builder
+			count int
+		)
+		err = filepath.WalkDir(
+			p.Path, func(path string, d fs.DirEntry, err error) error {
+				if err != nil {
+					return nil
+				}
+				if ctx.Err() != nil {
+					return ctx.Err()
+				}
+				if d.IsDir() {
+					if path != p.Path && strings.HasPrefix(d.Name(), ".") {
+						return filepath.SkipDir
+					}
+					return nil
+				}
+				// Symlinks may point out of the working directory.
+				if d.Type()&fs.ModeSymlink != 0 && workDirPath(path) != nil {
+					return nil
+				}
+				f, err := os.Open(path)
+				if err != nil {
+					return nil
+				}
+				defer func() { _ = f.Close() }()
+
+				scanner := bufio.NewScanner(f)
+				line := 0
+				for scanner.Scan() {
+					line++
+					text := scanner.Text()
+					if strings.ContainsRune(text, 0) {
+						return nil // binary file
+					}
+					if re.MatchString(text) {
+						_, _ = fmt.Fprintf(&sb, "%s:%d:%s\n", path, line, text)
+						count++
+						if count >= maxGrepResults {
+							return errTooManyResults
+						}
+					}
+				}
+				return nil
+			},
+		)
+		if errors.Is(err, errTooManyResults) {
+			sb.WriteString("... (too many results, use a more specific pattern)\n")
+		} else if err != nil {
+			return "", err
+		}
+		if count == 0 {
+			return "no matches found", nil
+		}
+		return sb.String(), nil
+	},
+}
+
+var currentTime = Tool{
+	Name:        "current_time",
+	Description: "Get the current local date and time.",
+	Parameters: json.RawMessage(`{
+  "type": "object",
+  "properties": {
+    "timezone": {"type": "string", "description": "IANA time zone name, e.g. Asia/Shanghai, defaults to the local time zone"}
+  }
+}`),
+	Run: func(ctx context.Context, args json.RawMessage) (string, error) {
+		var p struct {
+			Timezone string `json:"timezone"`
+		}
+		if err := parseArgs(args, &p); err != nil {
+			return "", err
+		}
+		now := time.Now()
+		if p.Timezone != "" {
+			loc, err := time.LoadLocation(p.Timezone)
+			if err != nil {
+				return "", err
+			}
+			now = now.In(loc)
+		}
+		return now.Format(time.RFC1123Z), nil
+	},
+}
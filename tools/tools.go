@@ -0,0 +1,103 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"unicode/utf8"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// MaxResultLength limits the size of a tool result sent back to the model.
+const MaxResultLength = 16 * 1024
+
+type Tool struct {
+	Name        string
+	Description string
+	// Parameters is the JSON schema of the tool arguments.
+	Parameters json.RawMessage
+	// SideEffect marks tools that modify something outside the conversation,
+	// the user must confirm before they are run.
+	SideEffect bool
+	Run        func(ctx context.Context, args json.RawMessage) (string, error)
+}
+
+type Registry struct {
+	tools map[string]Tool
+}
+
+func NewRegistry() *Registry {
+	return &Registry{tools: map[string]Tool{}}
+}
+
+func (r *Registry) Register(t Tool) {
+	r.tools[t.Name] = t
+}
+
+func (r *Registry) Get(name string) (Tool, bool) {
+	t, ok := r.tools[name]
+	return t, ok
+}
+
+func (r *Registry) Len() int {
+	return len(r.tools)
+}
+
+// Definitions returns the tool definitions to be sent in a chat completion request.
+func (r *Registry) Definitions() []openai.Tool {
+	names := make([]string, 0, len(r.tools))
+	for name := range r.tools {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	defs := make([]openai.Tool, 0, len(names))
+	for _, name := range names {
+		t := r.tools[name]
+		defs = append(
+			defs, openai.Tool{
+				Type: openai.ToolTypeFunction,
+				Function: &openai.FunctionDefinition{
+					Name:        t.Name,
+					Description: t.Description,
+					Parameters:  t.Parameters,
+				},
+			},
+		)
+	}
+	return defs
+}
+
+// Run runs the tool requested by the model. Errors are returned as the result,
+// so the model can see what went wrong and try again.
+func (r *Registry) Run(ctx context.Context, call openai.ToolCall) string {
+	t, ok := r.tools[call.Function.Name]
+	if !ok {
+		return fmt.Sprintf("error: unknown tool %q", call.Function.Name)
+	}
+	args := json.RawMessage(call.Function.Arguments)
+	if len(args) == 0 {
+		args = json.RawMessage("{}")
+	}
+	result, err := t.Run(ctx, args)
+	if err != nil {
+		return fmt.Sprintf("error: %v", err)
+	}
+	if len(result) > MaxResultLength {
+		result = truncate(result, MaxResultLength) + "\n... (truncated)"
+	}
+	return result
+}
+
+// truncate cuts s to at most n bytes, without splitting a UTF-8 character.
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
@@ -0,0 +1,159 @@
+package ui
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/key"
+	"github.com/charmbracelet/bubbles/textinput"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+type CommandAction int
+
+const (
+	CommandCancel CommandAction = iota
+	CommandExecute
+	CommandCopy
+)
+
+var (
+	commandStyle     = lipgloss.NewStyle().Bold(true).Foreground(lipgloss.Color("2"))
+	explanationStyle = lipgloss.NewStyle().Faint(true)
+	optionStyle      = lipgloss.NewStyle().Foreground(lipgloss.Color("8"))
+	activeOptionKey  = lipgloss.NewStyle().Bold(true).Foreground(lipgloss.Color("6"))
+)
+
+var commandKeys = struct {
+	Execute key.Binding
+	Edit    key.Binding
+	Copy    key.Binding
+	Cancel  key.Binding
+}{
+	Execute: key.NewBinding(key.WithKeys("enter", "x"), key.WithHelp("enter", "execute")),
+	Edit:    key.NewBinding(key.WithKeys("e"), key.WithHelp("e", "edit")),
+	Copy:    key.NewBinding(key.WithKeys("c"), key.WithHelp("c", "copy")),
+	Cancel:  key.NewBinding(key.WithKeys("q", "esc", "ctrl+c"), key.WithHelp("q", "cancel")),
+}
+
+type commandModel struct {
+	explanation string
+	input       textinput.Model
+	editing     bool
+	action      CommandAction
+}
+
+func (m commandModel) Init() tea.Cmd {
+	return nil
+}
+
+func (m commandModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	keyMsg, ok := msg.(tea.KeyMsg)
+	if !ok {
+		return m, nil
+	}
+	if m.editing {
+		switch keyMsg.String() {
+		case "enter", "esc":
+			m.editing = false
+			m.input.Blur()
+			return m, nil
+		}
+		var cmd tea.Cmd
+		m.input, cmd = m.input.Update(msg)
+		return m, cmd
+	}
+	switch {
+	case key.Matches(keyMsg, commandKeys.Execute):
+		m.action = CommandExecute
+		return m, tea.Quit
+	case key.Matches(keyMsg, commandKeys.Copy):
+		m.action = CommandCopy
+		return m, tea.Quit
+	case key.Matches(keyMsg, commandKeys.Cancel):
+		m.action = CommandCancel
+		return m, tea.Quit
+	case key.Matches(keyMsg, commandKeys.Edit):
+		m.editing = true
+		m.input.CursorEnd()
+		return m, m.input.Focus()
+	}
+	return m, nil
+}
+
+func (m commandModel) View() string {
+	var sb strings.Builder
+	if m.editing {
+		sb.WriteString(m.input.View())
+		sb.WriteString("\n")
+		sb.WriteString(optionStyle.Render("enter: done editing"))
+		sb.WriteString("\n")
+		return sb.String()
+	}
+	sb.WriteString(commandStyle.Render("$ " + m.input.Value()))
+	sb.WriteString("\n")
+	if m.explanation != "" {
+		sb.WriteString(explanationStyle.Render(m.explanation))
+		sb.WriteString("\n")
+	}
+	var options []string
+	for _, b := range []key.Binding{commandKeys.Execute, commandKeys.Edit, commandKeys.Copy, commandKeys.Cancel} {
+		options = append(options, fmt.Sprintf("%s %s", activeOptionKey.Render(b.Help().Key), optionStyle.Render(b.Help().Desc)))
+	}
+	sb.WriteString(strings.Join(options, optionStyle.Render(" • ")))
+	sb.WriteString("\n")
+	return sb.String()
+}
+
+// ConfirmCommand shows the suggested command, and asks the user what to do with it.
+// It returns the chosen action and the command, which may be edited by the user.
+func ConfirmCommand(command, explanation string) (CommandAction, string, error) {
+	input := textinput.New()
+	input.Prompt = "$ "
+	input.SetValue(command)
+
+	p := tea.NewProgram(
+		commandModel{explanation: explanation, input: input},
+		tea.WithOutput(os.Stderr),
+		tea.WithInputTTY(),
+	)
+	result, err := p.Run()
+	if err != nil {
+		return CommandCancel, command, err
+	}
+	m := result.(commandModel)
+	return m.action, strings.TrimSpace(m.input.Value()), nil
+}
+
+type yesNoModel struct {
+	question string
+	yes      bool
+}
+
+func (m yesNoModel) Init() tea.Cmd {
+	return nil
+}
+
+func (m yesNoModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	if keyMsg, ok := msg.(tea.KeyMsg); ok {
+		m.yes = keyMsg.String() == "y" || keyMsg.String() == "Y"
+		return m, tea.Quit
+	}
+	return m, nil
+}
+
+func (m yesNoModel) View() string {
+	return fmt.Sprintf("%s %s\n", m.question, optionStyle.Render("[y/N]"))
+}
+
+// Confirm asks a yes/no question, anything other than "y" means no.
+func Confirm(question string) (bool, error) {
+	p := tea.NewProgram(yesNoModel{question: question}, tea.WithOutput(os.Stderr), tea.WithInputTTY())
+	result, err := p.Run()
+	if err != nil {
+		return false, err
+	}
+	return result.(yesNoModel).yes, nil
+}
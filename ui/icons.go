@@ -5,4 +5,8 @@ const (
 	TokenIcon        = "T "
 	HelpIcon         = "? "
 	PromptIcon       = "> "
+	ImageIcon        = "@ "
+	ToolIcon         = "* "
+	ProfileIcon      = "~ "
+	CopyIcon         = "+ "
 )
@@ -16,6 +16,10 @@ const (
 )
 
 func newBinding(keys []string, help string) key.Binding {
+	// Reported by ValidateConfig, the action is left unbound.
+	if len(keys) == 0 {
+		return key.NewBinding(key.WithDisabled())
+	}
 	return key.NewBinding(key.WithKeys(keys...), key.WithHelp(keys[0], help))
 }
 
@@ -32,6 +36,8 @@ type keyMap struct {
 	NextConversation   key.Binding
 	RemoveConversation key.Binding
 	ForgetContext      key.Binding
+	AttachImage        key.Binding
+	SelectMessage      key.Binding
 	ViewPortKeys       viewport.KeyMap
 	TextAreaKeys       textarea.KeyMap
 }
@@ -42,7 +48,7 @@ func (k keyMap) ShortHelp() []key.Binding {
 
 func (k keyMap) FullHelp() [][]key.Binding {
 	return [][]key.Binding{
-		{k.Submit, k.Quit, k.SwitchMultiline, k.Copy, k.TextAreaKeys.Paste},
+		{k.Submit, k.Quit, k.SwitchMultiline, k.Copy, k.SelectMessage, k.TextAreaKeys.Paste, k.AttachImage},
 		{k.NewConversation, k.PrevConversation, k.NextConversation, k.ForgetContext, k.RemoveConversation},
 		{
 			k.PrevHistory,
@@ -69,6 +75,8 @@ func newKeyMap(conf chatgpt.KeyMapConfig) keyMap {
 		RemoveConversation: newBinding(conf.RemoveConversation, "remove current conversation"),
 		PrevConversation:   newBinding(conf.PreviousConversation, "previous conversation"),
 		NextConversation:   newBinding(conf.NextConversation, "next conversation"),
+		AttachImage:        newBinding(conf.AttachImage, "attach image (input is the file path)"),
+		SelectMessage:      newBinding(conf.SelectMessage, "select a message or code block to copy"),
 		ViewPortKeys: viewport.KeyMap{
 			PageDown: key.NewBinding(
 				key.WithKeys("pgdown"),
@@ -0,0 +1,91 @@
+package ui
+
+import (
+	"hash/fnv"
+	"strconv"
+
+	"github.com/j178/chatgpt"
+)
+
+// renderCache keeps the rendered messages of the conversation by content and width, so that only the pending
+// answer is rendered again on every streamed delta. Entries not used by the last render are dropped.
+type renderCache struct {
+	width   int
+	prev    map[uint64]string
+	curr    map[uint64]string
+	history renderedHistory
+}
+
+// renderedHistory is the rendering of the messages before a pending question, which don't change while its answer
+// streams in, so that a delta doesn't render the whole conversation again.
+type renderedHistory struct {
+	pending   *chatgpt.QnA
+	width     int
+	forgotten int
+	context   int
+	content   string
+}
+
+// matches reports whether the history was rendered for the conversation in its current state.
+func (h renderedHistory) matches(c *chatgpt.Conversation, width int) bool {
+	return c.Pending != nil && h.pending == c.Pending && h.width == width && h.forgotten == len(c.Forgotten) &&
+		h.context == len(c.Context)
+}
+
+func newRenderCache() *renderCache {
+	return &renderCache{prev: map[uint64]string{}, curr: map[uint64]string{}}
+}
+
+// reset drops all the entries, e.g. when the width or the style changes.
+func (c *renderCache) reset() {
+	c.prev = map[uint64]string{}
+	c.curr = map[uint64]string{}
+	c.history = renderedHistory{}
+}
+
+// get returns the cached rendering of the key, or renders it.
+func (c *renderCache) get(width int, key uint64, render func() string) string {
+	if width != c.width {
+		c.reset()
+		c.width = width
+	}
+	if s, ok := c.curr[key]; ok {
+		return s
+	}
+	s, ok := c.prev[key]
+	if !ok {
+		s = render()
+	}
+	c.curr[key] = s
+	return s
+}
+
+// sweep drops the entries not used since the last sweep, it's called after rendering the whole conversation.
+func (c *renderCache) sweep() {
+	c.prev, c.curr = c.curr, map[uint64]string{}
+}
+
+// qnaKey identifies the content of a question and its answer.
+func qnaKey(kind string, q chatgpt.QnA) uint64 {
+	h := fnv.New64a()
+	write := func(s string) {
+		_, _ = h.Write([]byte(s))
+		_, _ = h.Write([]byte{0})
+	}
+	write(kind)
+	write(q.Question)
+	for _, img := range q.Images {
+		write(img.Hash)
+	}
+	for _, round := range q.ToolRounds {
+		write(round.Content)
+		for _, call := range round.Calls {
+			write(call.Name)
+			write(call.Arguments)
+			write(call.Result)
+			write(strconv.FormatBool(call.Done))
+		}
+	}
+	write(q.Answer)
+	return h.Sum64()
+}
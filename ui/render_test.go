@@ -0,0 +1,82 @@
+package ui
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/j178/chatgpt"
+)
+
+// newBenchmarkModel returns a model showing a conversation of n questions with markdown answers.
+func newBenchmarkModel(b *testing.B, n int) Model {
+	b.Helper()
+	b.Setenv("CHATGPT_CONFIG_DIR", b.TempDir())
+	conf, err := chatgpt.ReadConfig()
+	if err != nil {
+		b.Fatal(err)
+	}
+	conf.APIKey = "sk-test"
+	conf.Conversation.ContextLength = n
+	bot, err := chatgpt.NewChatGPT(conf)
+	if err != nil {
+		b.Fatal(err)
+	}
+	conversations, err := chatgpt.NewConversationManager(conf, "")
+	if err != nil {
+		b.Fatal(err)
+	}
+	conv := conversations.New(conf.Conversation)
+	for i := 0; i < n; i++ {
+		conv.AddQuestion(fmt.Sprintf("How do I reverse a slice in Go, take %d?", i))
+		conv.UpdatePending(
+			fmt.Sprintf(
+				"Use **slices.Reverse**, take %d:\n\n```go\ns := []int{1, 2, 3}\nslices.Reverse(s)\n```\n\n"+
+					"- It reverses in place\n- It works with any element type\n", i,
+			),
+			true,
+		)
+	}
+	return InitialModel(conf, bot, conversations)
+}
+
+func BenchmarkRenderConversationCold(b *testing.B) {
+	m := newBenchmarkModel(b, 50)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		m.render.reset()
+		m.RenderConversation(100)
+	}
+}
+
+func BenchmarkRenderConversationWarm(b *testing.B) {
+	m := newBenchmarkModel(b, 50)
+	m.RenderConversation(100)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		m.RenderConversation(100)
+	}
+}
+
+// BenchmarkRenderStreamingDelta measures rendering the conversation on every delta of a streamed answer, which
+// shouldn't grow with the history.
+func BenchmarkRenderStreamingDelta(b *testing.B) {
+	for _, n := range []int{10, 100, 1000} {
+		b.Run(
+			fmt.Sprintf("history=%d", n), func(b *testing.B) {
+				m := newBenchmarkModel(b, n)
+				conv := m.conversations.Curr()
+				conv.AddQuestion("And how do I sort it?")
+				m.RenderConversation(100)
+				b.ResetTimer()
+				for i := 0; i < b.N; i++ {
+					// Start the answer over now and then, so that it doesn't grow with b.N.
+					if i%50 == 0 {
+						conv.Pending.Answer = ""
+					}
+					conv.UpdatePending("Use **slices.Sort**, it sorts in place. ", false)
+					m.RenderConversation(100)
+				}
+			},
+		)
+	}
+}
@@ -0,0 +1,200 @@
+package ui
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/key"
+	tea "github.com/charmbracelet/bubbletea"
+
+	"github.com/j178/chatgpt"
+)
+
+// message is a question or an answer of the conversation, which can be selected and copied.
+type message struct {
+	qna    int // index in the forgotten QnAs followed by the context ones
+	answer bool
+	text   string
+}
+
+// messages lists the questions and the non-empty answers of the conversation, the pending one is left out.
+func messages(c *chatgpt.Conversation) []message {
+	var msgs []message
+	for i, q := range append(append([]chatgpt.QnA{}, c.Forgotten...), c.Context...) {
+		msgs = append(msgs, message{qna: i, text: q.Question})
+		if q.Answer != "" {
+			msgs = append(msgs, message{qna: i, answer: true, text: q.Answer})
+		}
+	}
+	return msgs
+}
+
+// fence is an opening or closing line of a fenced code block.
+type fence struct {
+	indent int
+	marker string // the backticks or tildes
+}
+
+func parseFence(line string) (fence, bool) {
+	trimmed := strings.TrimLeft(line, " ")
+	indent := len(line) - len(trimmed)
+	if indent > 3 || len(trimmed) < 3 || (trimmed[0] != '`' && trimmed[0] != '~') {
+		return fence{}, false
+	}
+	n := len(trimmed) - len(strings.TrimLeft(trimmed, trimmed[:1]))
+	if n < 3 {
+		return fence{}, false
+	}
+	// The info string of a backtick fence can't contain backticks.
+	if trimmed[0] == '`' && strings.Contains(trimmed[n:], "`") {
+		return fence{}, false
+	}
+	return fence{indent: indent, marker: trimmed[:n]}, true
+}
+
+// closes reports whether the line closes the code block opened by f.
+func (f fence) closes(line string) bool {
+	g, ok := parseFence(line)
+	return ok && g.marker[0] == f.marker[0] && len(g.marker) >= len(f.marker) &&
+		strings.TrimSpace(strings.TrimLeft(line, " ")[len(g.marker):]) == ""
+}
+
+// codeBlocks extracts the code of the fenced code blocks in the markdown, without the fences. The indentation of
+// the opening fence is removed from the code, like markdown renderers do.
+func codeBlocks(markdown string) []string {
+	var (
+		blocks []string
+		open   *fence
+		code   []string
+	)
+	for _, line := range strings.Split(markdown, "\n") {
+		if open == nil {
+			if f, ok := parseFence(line); ok {
+				open, code = &f, nil
+			}
+			continue
+		}
+		if open.closes(line) {
+			blocks = append(blocks, strings.Join(code, "\n"))
+			open = nil
+			continue
+		}
+		for i := 0; i < open.indent && strings.HasPrefix(line, " "); i++ {
+			line = line[1:]
+		}
+		code = append(code, line)
+	}
+	// An unclosed block runs to the end, e.g. while it's still being answered.
+	if open != nil {
+		blocks = append(blocks, strings.Join(code, "\n"))
+	}
+	return blocks
+}
+
+// insertCodeHints adds the number of each fenced code block above it, the number copies the block in selection
+// mode.
+func insertCodeHints(markdown string) string {
+	var (
+		sb   strings.Builder
+		open *fence
+		n    int
+	)
+	lines := strings.Split(markdown, "\n")
+	for i, line := range lines {
+		if open == nil {
+			if f, ok := parseFence(line); ok {
+				open = &f
+				n++
+				_, _ = fmt.Fprintf(&sb, "\n%s`[%d]`\n\n", strings.Repeat(" ", f.indent), n)
+			}
+		} else if open.closes(line) {
+			open = nil
+		}
+		sb.WriteString(line)
+		if i < len(lines)-1 {
+			sb.WriteString("\n")
+		}
+	}
+	return sb.String()
+}
+
+// updateSelection handles the keys of selection mode: the arrows move between the messages, enter copies the
+// selected message, and a number copies the code of that block in it. A block is copied as soon as its number is
+// complete, e.g. 1 waits for another digit when there are 10 or more blocks, and enter copies block 1 then.
+func (m Model) updateSelection(msg tea.KeyMsg) (Model, tea.Cmd) {
+	msgs := messages(m.conversations.Curr())
+	if len(msgs) == 0 {
+		return m.stopSelection(), nil
+	}
+	m.selected = min(m.selected, len(msgs)-1)
+	blocks := codeBlocks(msgs[m.selected].text)
+	switch k := msg.String(); {
+	case len(k) == 1 && k[0] >= '0' && k[0] <= '9':
+		n, _ := strconv.Atoi(m.blockNum + k)
+		if n < 1 || n > len(blocks) {
+			return m, nil
+		}
+		if n*10 > len(blocks) {
+			return m.stopSelection().copy(blocks[n-1])
+		}
+		m.blockNum = strconv.Itoa(n)
+		return m, nil
+	case k == "backspace" && m.blockNum != "":
+		m.blockNum = m.blockNum[:len(m.blockNum)-1]
+		return m, nil
+	case k == "up" || k == "k" || k == "shift+tab":
+		m.selected = max(m.selected-1, 0)
+	case k == "down" || k == "j" || k == "tab":
+		m.selected = min(m.selected+1, len(msgs)-1)
+	case (k == "enter" || k == "y") && m.blockNum != "":
+		n, _ := strconv.Atoi(m.blockNum)
+		return m.stopSelection().copy(blocks[n-1])
+	case k == "enter" || k == "y":
+		return m.stopSelection().copy(msgs[m.selected].text)
+	case k == "esc" || k == "q" || key.Matches(msg, m.keymap.SelectMessage):
+		return m.stopSelection(), nil
+	default:
+		return m, nil
+	}
+	m.blockNum = ""
+	return m.scrollToSelection(), nil
+}
+
+func (m Model) stopSelection() Model {
+	m.selecting = false
+	m.blockNum = ""
+	m.textarea.Focus()
+	m.viewport.SetContent(m.RenderConversation(m.viewport.Width))
+	m.viewport.GotoBottom()
+	return m
+}
+
+// scrollToSelection renders the selection, and scrolls to the selected message if it's out of sight.
+func (m Model) scrollToSelection() Model {
+	content, line := m.renderConversation(m.viewport.Width)
+	m.viewport.SetContent(content)
+	if line < m.viewport.YOffset || line >= m.viewport.YOffset+m.viewport.Height {
+		m.viewport.SetYOffset(line)
+	}
+	return m
+}
+
+// selectionHelp describes the keys of selection mode.
+func (m Model) selectionHelp() string {
+	msgs := messages(m.conversations.Curr())
+	if m.selected >= len(msgs) {
+		return ""
+	}
+	if m.blockNum != "" {
+		return fmt.Sprintf("code block %s_, enter copy, esc cancel", m.blockNum)
+	}
+	help := "↑/↓ select, enter copy"
+	switch n := len(codeBlocks(msgs[m.selected].text)); {
+	case n == 1:
+		help += ", 1 copy code"
+	case n > 1:
+		help += fmt.Sprintf(", 1-%d copy code", n)
+	}
+	return help + ", esc cancel"
+}
@@ -0,0 +1,111 @@
+package ui
+
+import (
+	"os"
+
+	"github.com/charmbracelet/glamour"
+	glamourstyles "github.com/charmbracelet/glamour/styles"
+	"github.com/charmbracelet/lipgloss"
+
+	"github.com/j178/chatgpt"
+)
+
+// palette holds the colors of a theme.
+type palette struct {
+	user, bot, err, confirm, border string
+	// faint renders images and tool calls with faint text, which is hard to read in high contrast mode.
+	faint bool
+	// glamour is the markdown style, empty to follow the terminal background.
+	glamour string
+}
+
+var palettes = map[string]palette{
+	"dark":          {user: "5", bot: "6", err: "1", confirm: "3", border: "8", faint: true, glamour: glamourstyles.DarkStyle},
+	"light":         {user: "90", bot: "24", err: "124", confirm: "94", border: "246", faint: true, glamour: glamourstyles.LightStyle},
+	"high-contrast": {user: "13", bot: "14", err: "9", confirm: "11", border: "15"},
+}
+
+// styles are the styles of the TUI, built from the theme config.
+type styles struct {
+	sender    lipgloss.Style
+	bot       lipgloss.Style
+	err       lipgloss.Style
+	confirm   lipgloss.Style
+	image     lipgloss.Style
+	tool      lipgloss.Style
+	footer    lipgloss.Style
+	userLabel string
+	botLabel  string
+	glamour   string
+}
+
+func newStyles(conf chatgpt.ThemeConfig, darkBackground bool) styles {
+	name := conf.Name
+	if _, ok := palettes[name]; !ok {
+		name = "dark"
+		if !darkBackground {
+			name = "light"
+		}
+	}
+	p := palettes[name]
+	override := func(color *string, custom string) {
+		if custom != "" {
+			*color = custom
+		}
+	}
+	override(&p.user, conf.Colors.User)
+	override(&p.bot, conf.Colors.Bot)
+	override(&p.err, conf.Colors.Error)
+	override(&p.confirm, conf.Colors.Confirm)
+	override(&p.border, conf.Colors.Border)
+
+	s := styles{
+		sender:    lipgloss.NewStyle().Bold(true).Foreground(lipgloss.Color(p.user)),
+		bot:       lipgloss.NewStyle().Bold(true).Foreground(lipgloss.Color(p.bot)),
+		err:       lipgloss.NewStyle().Bold(true).Foreground(lipgloss.Color(p.err)),
+		confirm:   lipgloss.NewStyle().Bold(true).Foreground(lipgloss.Color(p.confirm)),
+		image:     lipgloss.NewStyle().PaddingLeft(2).Faint(p.faint),
+		tool:      lipgloss.NewStyle().PaddingLeft(2).Faint(p.faint),
+		userLabel: "You",
+		botLabel:  "ChatGPT",
+		footer: lipgloss.NewStyle().
+			Height(1).
+			BorderTop(true).
+			BorderStyle(lipgloss.NormalBorder()).
+			BorderForeground(lipgloss.Color(p.border)).
+			Faint(p.faint),
+	}
+	if conf.UserLabel != "" {
+		s.userLabel = conf.UserLabel
+	}
+	if conf.BotLabel != "" {
+		s.botLabel = conf.BotLabel
+	}
+
+	// The style of the config comes first, then $GLAMOUR_STYLE, then the theme's style.
+	s.glamour = conf.GlamourStyle
+	if s.glamour == "" {
+		s.glamour = os.Getenv("GLAMOUR_STYLE")
+	}
+	if s.glamour == "" {
+		s.glamour = p.glamour
+	}
+	if s.glamour == "" {
+		s.glamour = defaultGlamourStyle(darkBackground)
+	}
+	return s
+}
+
+func defaultGlamourStyle(darkBackground bool) string {
+	if darkBackground {
+		return glamourstyles.DarkStyle
+	}
+	return glamourstyles.LightStyle
+}
+
+func newRenderer(style string) (*glamour.TermRenderer, error) {
+	return glamour.NewTermRenderer(
+		glamour.WithStylePath(style),
+		glamour.WithWordWrap(0), // we do hard-wrapping ourselves
+	)
+}
@@ -5,10 +5,11 @@ import (
 	"fmt"
 	"io"
 	"log"
+	"os"
+	"reflect"
 	"strings"
 	"time"
 
-	"github.com/atotto/clipboard"
 	"github.com/charmbracelet/bubbles/cursor"
 	"github.com/charmbracelet/bubbles/help"
 	"github.com/charmbracelet/bubbles/key"
@@ -18,8 +19,12 @@ import (
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/charmbracelet/glamour"
 	"github.com/charmbracelet/lipgloss"
+	"github.com/mitchellh/go-homedir"
+	"github.com/muesli/reflow/truncate"
 	"github.com/muesli/reflow/wordwrap"
 	"github.com/muesli/reflow/wrap"
+	"github.com/muesli/termenv"
+	"github.com/sashabaranov/go-openai"
 
 	"github.com/j178/chatgpt"
 	"github.com/j178/chatgpt/tokenizer"
@@ -30,8 +35,30 @@ type (
 	deltaAnswerMsg string
 	answerMsg      string
 	saveMsg        struct{}
+	retryMsg       chatgpt.RetryEvent
+	toolResultMsg  struct {
+		id     string
+		result string
+	}
 )
 
+// ConfigMsg carries the reloaded config.
+type ConfigMsg chatgpt.ConfigUpdate
+
+// copiedMsg reports the result of copying to the clipboard.
+type copiedMsg struct {
+	backend string
+	err     error
+}
+
+// warningMsg shows a problem that doesn't stop the answer. It's a struct, an error type would also match errMsg.
+type warningMsg struct {
+	err error
+}
+
+// configWarningsMsg shows the warnings of the config file.
+type configWarningsMsg []chatgpt.ConfigProblem
+
 var (
 	Debug      bool
 	DetachMode bool
@@ -53,6 +80,19 @@ type Model struct {
 	chatgpt       *chatgpt.ChatGPT
 	conversations *chatgpt.ConversationManager
 	renderer      *glamour.TermRenderer
+	render        *renderCache
+	styles        styles
+	darkBg        bool              // detected once at startup, querying the terminal while the program runs would garble the input
+	images        []chatgpt.Image   // images attached to the next question
+	confirmTool   *chatgpt.ToolCall // side-effecting tool call waiting for user confirmation
+	retries       chan chatgpt.RetryEvent
+	retry         *chatgpt.RetryEvent // the failed request waiting to be retried
+	retryAt       time.Time
+	selecting     bool   // selecting a message to copy
+	selected      int    // index of the selected message in messages()
+	blockNum      string // digits typed so far to pick a code block of the selected message
+	status        string // shown in the footer for a few seconds, e.g. after copying
+	statusID      int
 }
 
 func InitialModel(
@@ -78,13 +118,17 @@ func InitialModel(
 
 	vp := viewport.New(50, 5)
 	spin := spinner.New(spinner.WithSpinner(spinner.Points))
-	renderer, _ := glamour.NewTermRenderer(
-		glamour.WithEnvironmentConfig(),
-		glamour.WithWordWrap(0), // we do hard-wrapping ourselves
-	)
+	darkBg := termenv.HasDarkBackground()
+	styles := newStyles(conf.Theme, darkBg)
+	renderer, err := newRenderer(styles.glamour)
+	if err != nil {
+		styles.glamour = defaultGlamourStyle(darkBg)
+		renderer, _ = newRenderer(styles.glamour)
+	}
 
 	keymap := newKeyMap(conf.KeyMap)
 	m := Model{
+		retries:       notifyRetries(chatgpt),
 		textarea:      ta,
 		viewport:      vp,
 		help:          help.New(),
@@ -95,6 +139,10 @@ func InitialModel(
 		historyIdx:    conversations.Curr().Len(),
 		keymap:        keymap,
 		renderer:      renderer,
+		render:        newRenderCache(),
+		styles:        styles,
+		darkBg:        darkBg,
+		err:           err,
 	}
 	m = m.SetInputMode(InputModelSingleLine)
 	return m
@@ -104,14 +152,37 @@ func savePeriodically() tea.Cmd {
 	return tea.Tick(15*time.Second, func(time.Time) tea.Msg { return saveMsg{} })
 }
 
+// notifyRetries returns a channel receiving the retry events of the bot, events are dropped if not received in time.
+func notifyRetries(bot *chatgpt.ChatGPT) chan chatgpt.RetryEvent {
+	retries := make(chan chatgpt.RetryEvent, 1)
+	bot.OnRetry(
+		func(e chatgpt.RetryEvent) {
+			select {
+			case retries <- e:
+			default:
+			}
+		},
+	)
+	return retries
+}
+
+func waitRetry(retries <-chan chatgpt.RetryEvent) tea.Cmd {
+	return func() tea.Msg {
+		return retryMsg(<-retries)
+	}
+}
+
 func (m Model) Init() tea.Cmd {
-	cmds := []tea.Cmd{tea.EnterAltScreen}
+	cmds := []tea.Cmd{tea.EnterAltScreen, waitRetry(m.retries)}
 	if !Debug { // disable blink when debug
 		cmds = append(cmds, textarea.Blink)
 	}
 	if !DetachMode {
 		cmds = append(cmds, savePeriodically())
 	}
+	if warnings := m.globalConf.Warnings; len(warnings) > 0 {
+		cmds = append(cmds, func() tea.Msg { return configWarningsMsg(warnings) })
+	}
 	return tea.Batch(cmds...)
 }
 
@@ -137,6 +208,7 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		m.viewport.Width = msg.Width
 		m.viewport.Height = msg.Height - m.textarea.Height() - lipgloss.Height(m.RenderFooter())
 		m.textarea.SetWidth(msg.Width)
+		m.render.reset()
 		m.viewport.SetContent(m.RenderConversation(m.viewport.Width))
 		m.viewport.GotoBottom()
 	case spinner.TickMsg:
@@ -145,6 +217,29 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			cmds = append(cmds, cmd)
 		}
 	case tea.KeyMsg:
+		// Keys select and copy in selection mode, except the quit keys other than esc.
+		if m.selecting && (msg.Type == tea.KeyEsc || !key.Matches(msg, m.keymap.Quit)) {
+			m, cmd = m.updateSelection(msg)
+			cmds = append(cmds, cmd)
+			return m, tea.Batch(cmds...)
+		}
+		if m.confirmTool != nil {
+			call := *m.confirmTool
+			switch msg.String() {
+			case "y", "Y":
+				m.confirmTool = nil
+				cmds = append(cmds, m.runTool(call))
+				return m, tea.Batch(cmds...)
+			case "n", "N":
+				m.confirmTool = nil
+				m.conversations.Curr().SetToolResult(call.ID, "error: the user declined to run this tool")
+				m, cmd = m.nextToolCall()
+				cmds = append(cmds, cmd)
+				m.viewport.SetContent(m.RenderConversation(m.viewport.Width))
+				m.viewport.GotoBottom()
+				return m, tea.Batch(cmds...)
+			}
+		}
 		switch {
 		case key.Matches(msg, m.keymap.ToggleHelp):
 			m.help.ShowAll = !m.help.ShowAll
@@ -158,23 +253,9 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			if input == "" {
 				break
 			}
-			m.conversations.Curr().AddQuestion(input)
-			cmds = append(
-				cmds,
-				func() tea.Msg {
-					content, hasMore, err := m.chatgpt.Send(
-						m.conversations.Curr().Config,
-						m.conversations.Curr().GetContextMessages(),
-					)
-					if err != nil {
-						return errMsg(err)
-					}
-					if hasMore {
-						return deltaAnswerMsg(content)
-					}
-					return answerMsg(content)
-				},
-			)
+			m.conversations.Curr().AddQuestion(input, m.images...)
+			m.images = nil
+			cmds = append(cmds, m.send())
 			// Start answer spinner
 			m.answering = true
 			cmds = append(
@@ -233,6 +314,27 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			m.viewport.SetContent(m.RenderConversation(m.viewport.Width))
 			m.viewport.GotoBottom()
 			m.historyIdx = m.conversations.Curr().Len()
+		case key.Matches(msg, m.keymap.AttachImage):
+			if m.answering {
+				break
+			}
+			path := strings.TrimSpace(m.textarea.Value())
+			if path == "" {
+				break
+			}
+			path, err := homedir.Expand(path)
+			if err != nil {
+				m.err = err
+				break
+			}
+			img, err := chatgpt.SaveImage(path)
+			if err != nil {
+				m.err = err
+				break
+			}
+			m.err = nil
+			m.images = append(m.images, img)
+			m.textarea.Reset()
 		case key.Matches(msg, m.keymap.SwitchMultiline):
 			if m.inputMode == InputModelSingleLine {
 				m = m.SetInputMode(InputModelMultiLine)
@@ -245,7 +347,17 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			if m.answering || m.conversations.Curr().LastAnswer() == "" {
 				break
 			}
-			_ = clipboard.WriteAll(m.conversations.Curr().LastAnswer())
+			m, cmd = m.copy(m.conversations.Curr().LastAnswer())
+			cmds = append(cmds, cmd)
+		case key.Matches(msg, m.keymap.SelectMessage):
+			msgs := messages(m.conversations.Curr())
+			if m.answering || m.confirmTool != nil || len(msgs) == 0 {
+				break
+			}
+			m.selecting = true
+			m.selected = len(msgs) - 1
+			m.textarea.Blur()
+			m = m.scrollToSelection()
 		case key.Matches(msg, m.keymap.NextHistory):
 			if m.answering {
 				break
@@ -275,21 +387,26 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			}
 			return m, tea.Quit
 		}
+	case retryMsg:
+		e := chatgpt.RetryEvent(msg)
+		m.retry = &e
+		m.retryAt = time.Now().Add(e.Delay)
+		cmds = append(cmds, waitRetry(m.retries))
 	case deltaAnswerMsg:
+		m.retry = nil
 		m.conversations.Curr().UpdatePending(string(msg), false)
-		cmds = append(
-			cmds, func() tea.Msg {
-				content, err := m.chatgpt.Recv()
-				if err != nil {
-					return errMsg(err)
-				}
-				return deltaAnswerMsg(content)
-			},
-		)
+		cmds = append(cmds, m.recv())
 		m.err = nil
 		m.viewport.SetContent(m.RenderConversation(m.viewport.Width))
 		m.viewport.GotoBottom()
 	case answerMsg:
+		m.retry = nil
+		if calls := m.chatgpt.ToolCalls(); len(calls) > 0 {
+			m.conversations.Curr().UpdatePending(string(msg), false)
+			m, cmd = m.startToolCalls(calls)
+			cmds = append(cmds, cmd)
+			break
+		}
 		m.conversations.Curr().UpdatePending(string(msg), true)
 		m.answering = false
 		m.chatgpt.Done()
@@ -297,12 +414,82 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		m.viewport.GotoBottom()
 		m.textarea.Placeholder = "Send a message..."
 		m.textarea.Focus()
+	case toolResultMsg:
+		m.conversations.Curr().SetToolResult(msg.id, msg.result)
+		m, cmd = m.nextToolCall()
+		cmds = append(cmds, cmd)
+		m.viewport.SetContent(m.RenderConversation(m.viewport.Width))
+		m.viewport.GotoBottom()
+	case ConfigMsg:
+		if msg.Err != nil {
+			m.err = msg.Err
+			break
+		}
+		// A change that introduces errors is not applied, the previous config is kept.
+		if len(msg.NewErrors) > 0 {
+			m.err = errors.New(msg.NewErrors[0].String())
+			break
+		}
+		m.err = nil
+		switch {
+		case !reflect.DeepEqual(msg.Config.MCPServers, m.globalConf.MCPServers):
+			m, cmd = m.setStatus("MCP servers changed, restart to apply")
+			cmds = append(cmds, cmd)
+		case len(msg.Problems) > 0:
+			m, cmd = m.setStatus(problemsStatus(msg.Problems))
+			cmds = append(cmds, cmd)
+		}
+		m.globalConf = msg.Config
+		m.keymap = newKeyMap(msg.Config.KeyMap)
+		m = m.SetInputMode(m.inputMode)
+		m.conversations.SetConfig(msg.Config)
+		m.chatgpt.UpdateConfig(msg.Config)
+		styles := newStyles(msg.Config.Theme, m.darkBg)
+		if styles.glamour != m.styles.glamour {
+			renderer, err := newRenderer(styles.glamour)
+			if err != nil {
+				m.err = err
+				break
+			}
+			m.renderer = renderer
+		}
+		m.styles = styles
+		m.render.reset()
+		m.viewport.SetContent(m.RenderConversation(m.viewport.Width))
+	case copiedMsg:
+		if msg.err != nil {
+			m.err = msg.err
+			break
+		}
+		m.err = nil
+		status := fmt.Sprintf("%s copied", CopyIcon)
+		if msg.backend == chatgpt.ClipboardOSC52 {
+			status += " via OSC 52"
+		}
+		m, cmd = m.setStatus(status)
+		cmds = append(cmds, cmd)
+	case warningMsg:
+		m, cmd = m.setStatus(fmt.Sprintf("warning: %v", msg.err))
+		cmds = append(cmds, cmd)
+	case configWarningsMsg:
+		m, cmd = m.setStatus(problemsStatus(msg))
+		cmds = append(cmds, cmd)
+	case clearStatusMsg:
+		if int(msg) == m.statusID {
+			m.status = ""
+		}
 	case saveMsg:
 		_ = m.conversations.Dump()
 		cmds = append(cmds, savePeriodically())
 	case errMsg:
+		m.retry = nil
 		// Network problem or answer completed, can't tell
 		if msg == io.EOF {
+			if calls := m.chatgpt.ToolCalls(); len(calls) > 0 {
+				m, cmd = m.startToolCalls(calls)
+				cmds = append(cmds, cmd)
+				break
+			}
 			if m.conversations.Curr().PendingAnswer() == "" {
 				m.err = errors.New("unexpected EOF, please try again")
 			}
@@ -321,6 +508,122 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	return m, tea.Batch(cmds...)
 }
 
+// statusDuration is how long a status is shown in the footer.
+const statusDuration = 3 * time.Second
+
+type clearStatusMsg int
+
+// setStatus shows the status in the footer, until it's replaced or cleared after a while.
+func (m Model) setStatus(status string) (Model, tea.Cmd) {
+	m.status = status
+	m.statusID++
+	id := m.statusID
+	return m, tea.Tick(statusDuration, func(time.Time) tea.Msg { return clearStatusMsg(id) })
+}
+
+// problemsStatus summarizes the problems of the config file for the footer.
+func problemsStatus(problems []chatgpt.ConfigProblem) string {
+	p := problems[0]
+	status := "config: " + p.Message
+	if p.Key != "" {
+		status = fmt.Sprintf("config %s: %s", p.Key, p.Message)
+	}
+	if len(problems) > 1 {
+		status += fmt.Sprintf(" (+%d more, see `chatgpt config validate`)", len(problems)-1)
+	}
+	return status
+}
+
+// copy copies the text to the clipboard in the background, since the clipboard utility may take a while. The
+// OSC 52 fallback is written to the terminal in a single write, which doesn't interleave with the frames of the
+// renderer: writes to the same file are serialized.
+func (m Model) copy(text string) (Model, tea.Cmd) {
+	return m, func() tea.Msg {
+		backend, err := chatgpt.CopyToClipboard(text, os.Stdout)
+		return copiedMsg{backend: backend, err: err}
+	}
+}
+
+// defaultFrameRate is how many times per second a streamed answer is rendered by default.
+const defaultFrameRate = 30
+
+// recv waits for the next frame, then receives the content streamed meanwhile as one delta.
+func (m Model) recv() tea.Cmd {
+	fps := m.globalConf.FrameRate
+	if fps <= 0 {
+		fps = defaultFrameRate
+	}
+	return tea.Tick(
+		time.Second/time.Duration(fps), func(time.Time) tea.Msg {
+			content, err := m.chatgpt.Recv()
+			if err != nil {
+				return errMsg(err)
+			}
+			return deltaAnswerMsg(content)
+		},
+	)
+}
+
+func (m Model) send() tea.Cmd {
+	conv := m.conversations.Curr()
+	messages, err := conv.GetContextMessages()
+	// Images of earlier questions that can't be read are left out, the images of the question itself are needed.
+	var (
+		imagesErr *chatgpt.ImagesError
+		warn      tea.Cmd
+	)
+	if errors.As(err, &imagesErr) {
+		warn = func() tea.Msg { return warningMsg{imagesErr} }
+		err = nil
+	} else if err != nil {
+		conv.DiscardPending()
+	}
+	return tea.Batch(
+		warn, func() tea.Msg {
+			if err != nil {
+				return errMsg(err)
+			}
+			content, hasMore, err := m.chatgpt.Send(conv.Config, messages)
+			if err != nil {
+				return errMsg(err)
+			}
+			if hasMore {
+				return deltaAnswerMsg(content)
+			}
+			return answerMsg(content)
+		},
+	)
+}
+
+func (m Model) startToolCalls(calls []openai.ToolCall) (Model, tea.Cmd) {
+	m.chatgpt.Done()
+	m.conversations.Curr().AddToolCalls(calls)
+	m.viewport.SetContent(m.RenderConversation(m.viewport.Width))
+	m.viewport.GotoBottom()
+	return m.nextToolCall()
+}
+
+// nextToolCall runs the next pending tool call, or sends the tool results back to the model once all calls are done.
+func (m Model) nextToolCall() (Model, tea.Cmd) {
+	call := m.conversations.Curr().NextToolCall()
+	if call == nil {
+		return m, m.send()
+	}
+	if t, ok := m.chatgpt.Tools().Get(call.Name); ok && t.SideEffect {
+		c := *call
+		m.confirmTool = &c
+		return m, nil
+	}
+	return m, m.runTool(*call)
+}
+
+func (m Model) runTool(call chatgpt.ToolCall) tea.Cmd {
+	return func() tea.Msg {
+		result := m.chatgpt.RunTool(call.ToolCall())
+		return toolResultMsg{id: call.ID, result: result}
+	}
+}
+
 func (m Model) SetInputMode(mode InputMode) Model {
 	keys := m.globalConf.KeyMap
 	if mode == InputModelMultiLine {
@@ -343,28 +646,33 @@ func (m Model) SetInputMode(mode InputMode) Model {
 	return m
 }
 
-var (
-	senderStyle = lipgloss.NewStyle().Bold(true).Foreground(lipgloss.Color("5"))
-	botStyle    = lipgloss.NewStyle().Bold(true).Foreground(lipgloss.Color("6"))
-	errorStyle  = lipgloss.NewStyle().Bold(true).Foreground(lipgloss.Color("1"))
-	footerStyle = lipgloss.NewStyle().
-			Height(1).
-			BorderTop(true).
-			BorderStyle(lipgloss.NormalBorder()).
-			BorderForeground(lipgloss.Color("8")).
-			Faint(true)
-)
+// maxToolResultLines limits how many lines of a tool result are shown in the conversation.
+const maxToolResultLines = 5
 
 func (m Model) RenderConversation(maxWidth int) string {
+	content, _ := m.renderConversation(maxWidth)
+	return content
+}
+
+// renderConversation also returns the line where the selected message starts in selection mode.
+func (m Model) renderConversation(maxWidth int) (string, int) {
 	var sb strings.Builder
 	c := m.conversations.Curr()
 	if c == nil {
-		return ""
+		return "", 0
 	}
 	renderer := m.renderer
 
-	renderYou := func(content string) {
-		sb.WriteString(senderStyle.Render("You: "))
+	// label highlights the selected message, and numbers its code blocks to copy them.
+	label := func(style lipgloss.Style, name string, content *string, selected bool) string {
+		if selected {
+			style = style.Reverse(true)
+			*content = insertCodeHints(*content)
+		}
+		return style.Render(name + ": ")
+	}
+	renderYou := func(sb *strings.Builder, content string, images []chatgpt.Image, selected bool) {
+		sb.WriteString(label(m.styles.sender, m.styles.userLabel, &content, selected))
 		if chatgpt.ContainsCJK(content) {
 			content = wrap.String(content, maxWidth-5)
 		} else {
@@ -372,12 +680,16 @@ func (m Model) RenderConversation(maxWidth int) string {
 		}
 		content, _ = renderer.Render(content)
 		sb.WriteString(chatgpt.EnsureTrailingNewline(content))
+		for _, img := range images {
+			sb.WriteString(m.styles.image.Render(fmt.Sprintf("%s%s", ImageIcon, img.ShortHash())))
+			sb.WriteString("\n")
+		}
 	}
-	renderBot := func(content string) {
+	renderBot := func(sb *strings.Builder, content string, selected bool) {
 		if content == "" {
 			return
 		}
-		sb.WriteString(botStyle.Render("ChatGPT: "))
+		sb.WriteString(label(m.styles.bot, m.styles.botLabel, &content, selected))
 		if chatgpt.ContainsCJK(content) {
 			content = wrap.String(content, maxWidth-5)
 		} else {
@@ -386,28 +698,120 @@ func (m Model) RenderConversation(maxWidth int) string {
 		content, _ = renderer.Render(content)
 		sb.WriteString(chatgpt.EnsureTrailingNewline(content))
 	}
-	for _, m := range c.Forgotten {
-		renderYou(m.Question)
-		renderBot(m.Answer)
+	renderTools := func(sb *strings.Builder, rounds []chatgpt.ToolRound) {
+		for _, round := range rounds {
+			renderBot(sb, round.Content, false)
+			for _, call := range round.Calls {
+				line := fmt.Sprintf("%s%s(%s)", ToolIcon, call.Name, call.Arguments)
+				sb.WriteString(m.styles.tool.Render(wrap.String(line, maxWidth-2)))
+				sb.WriteString("\n")
+				if !call.Done {
+					continue
+				}
+				result := strings.TrimSpace(call.Result)
+				if lines := strings.Split(result, "\n"); len(lines) > maxToolResultLines {
+					result = strings.Join(lines[:maxToolResultLines], "\n") + "\n..."
+				}
+				sb.WriteString(m.styles.tool.Render(wrap.String(result, maxWidth-2)))
+				sb.WriteString("\n")
+			}
+		}
+	}
+
+	var (
+		selected     *message
+		selectedLine int
+	)
+	if m.selecting {
+		if msgs := messages(c); m.selected < len(msgs) {
+			selected = &msgs[m.selected]
+		}
 	}
-	if len(c.Forgotten) > 0 {
-		sb.WriteString(lipgloss.NewStyle().PaddingLeft(5).Faint(true).Render("----- New Session -----"))
-		sb.WriteString("\n")
+	renderQnA := func(i int, q chatgpt.QnA) string {
+		// The selected message is rendered differently, so it isn't cached.
+		if selected != nil && selected.qna == i {
+			var qsb strings.Builder
+			line := strings.Count(sb.String(), "\n")
+			renderYou(&qsb, q.Question, q.Images, !selected.answer)
+			renderTools(&qsb, q.ToolRounds)
+			if selected.answer {
+				line += strings.Count(qsb.String(), "\n")
+			}
+			renderBot(&qsb, q.Answer, selected.answer)
+			selectedLine = line
+			return qsb.String()
+		}
+		return m.render.get(
+			maxWidth, qnaKey("qna", q), func() string {
+				var sb strings.Builder
+				renderYou(&sb, q.Question, q.Images, false)
+				renderTools(&sb, q.ToolRounds)
+				renderBot(&sb, q.Answer, false)
+				return sb.String()
+			},
+		)
 	}
-	for _, q := range c.Context {
-		renderYou(q.Question)
-		renderBot(q.Answer)
+	// While an answer streams in, the history is rendered once, and only the pending answer on every delta.
+	cached := selected == nil && m.render.history.matches(c, maxWidth)
+	if cached {
+		sb.Grow(len(m.render.history.content) + len(c.Pending.Answer))
+		sb.WriteString(m.render.history.content)
+	} else {
+		for i, q := range c.Forgotten {
+			sb.WriteString(renderQnA(i, q))
+		}
+		if len(c.Forgotten) > 0 {
+			sb.WriteString(lipgloss.NewStyle().PaddingLeft(5).Faint(true).Render("----- New Session -----"))
+			sb.WriteString("\n")
+		}
+		for i, q := range c.Context {
+			sb.WriteString(renderQnA(len(c.Forgotten)+i, q))
+		}
+		if selected == nil {
+			m.render.history = renderedHistory{
+				pending:   c.Pending,
+				width:     maxWidth,
+				forgotten: len(c.Forgotten),
+				context:   len(c.Context),
+				content:   sb.String(),
+			}
+		}
 	}
-	if c.Pending != nil {
-		renderYou(c.Pending.Question)
-		renderBot(c.Pending.Answer)
+	// Only the question of the pending answer is cached, the answer changes with every delta.
+	if q := c.Pending; q != nil {
+		question := chatgpt.QnA{Question: q.Question, Images: q.Images}
+		sb.WriteString(
+			m.render.get(
+				maxWidth, qnaKey("question", question), func() string {
+					var sb strings.Builder
+					renderYou(&sb, q.Question, q.Images, false)
+					return sb.String()
+				},
+			),
+		)
+		renderTools(&sb, q.ToolRounds)
+		renderBot(&sb, q.Answer, false)
+	}
+	// The history entries are not looked up when it's cached, they would be dropped.
+	if !cached {
+		m.render.sweep()
 	}
-	return sb.String()
+	return sb.String(), selectedLine
 }
 
 func (m Model) RenderFooter() string {
 	if m.err != nil {
-		return footerStyle.Render(errorStyle.Render(fmt.Sprintf("error: %v", m.err)))
+		return m.styles.footer.Render(m.styles.err.Render(fmt.Sprintf("error: %v", m.err)))
+	}
+	if m.selecting {
+		return m.styles.footer.Render(m.styles.confirm.Render(m.selectionHelp()))
+	}
+	if m.confirmTool != nil {
+		prompt := fmt.Sprintf("Run %s(%s)? [y/n]", m.confirmTool.Name, m.confirmTool.Arguments)
+		if lipgloss.Width(prompt) > m.width {
+			prompt = fmt.Sprintf("Run %s? [y/n]", m.confirmTool.Name)
+		}
+		return m.styles.footer.Render(m.styles.confirm.Render(prompt))
 	}
 
 	// spinner
@@ -418,20 +822,56 @@ func (m Model) RenderFooter() string {
 		columns = append(columns, m.spin.Spinner.Frames[0])
 	}
 
+	// status of the last action
+	if m.status != "" {
+		columns = append(columns, m.status)
+	}
+
+	// retry countdown
+	if m.answering && m.retry != nil {
+		e := *m.retry
+		e.Delay = max(time.Until(m.retryAt), 0)
+		columns = append(columns, e.String())
+	}
+
 	// conversation indicator
 	if m.conversations.Len() > 1 {
 		conversationIdx := fmt.Sprintf("%s %d/%d", ConversationIcon, m.conversations.Idx+1, m.conversations.Len())
 		columns = append(columns, conversationIdx)
 	}
 
+	// profile of the conversation
+	if profile := m.conversations.Curr().Config.Profile; profile != "" {
+		columns = append(columns, fmt.Sprintf("%s %s", ProfileIcon, profile))
+	}
+
+	// attached images
+	if len(m.images) > 0 {
+		columns = append(columns, fmt.Sprintf("%s %d", ImageIcon, len(m.images)))
+	}
+
 	// token count
 	question := m.textarea.Value()
-	if m.conversations.Curr().Len() > 0 || len(question) > 0 {
+	if m.conversations.Curr().Len() > 0 || len(question) > 0 || len(m.images) > 0 {
 		tokens := m.conversations.Curr().GetContextTokens()
 		if len(question) > 0 {
 			tokens += tokenizer.CountTokens(m.conversations.Curr().Config.Model, question) + 5
 		}
-		columns = append(columns, fmt.Sprintf("%s %d", TokenIcon, tokens))
+		for _, img := range m.images {
+			if url, err := img.DataURL(); err == nil {
+				tokens += tokenizer.CountImageTokens(m.conversations.Curr().Config.Model, url)
+			}
+		}
+		// Tokens of models with an unknown tokenizer are estimated.
+		approx := ""
+		if tokenizer.Estimated(m.conversations.Curr().Config.Model) {
+			approx = "~"
+		}
+		count := fmt.Sprintf("%s %s%d", TokenIcon, approx, tokens)
+		if window := m.globalConf.ModelInfo(m.conversations.Curr().Config.Model).ContextWindow; window > 0 {
+			count += "/" + shortTokens(window)
+		}
+		columns = append(columns, count)
 	}
 
 	// help
@@ -452,18 +892,33 @@ func (m Model) RenderFooter() string {
 	// truncate last column
 	if totalWidth+(n-1)*padding > m.width {
 		w := lipgloss.Width(strings.Join(columns[:n-1], ""))
-		remainingSpace := m.width - (w + (n-2)*padding + len("..."))
-		columns[n-1] = columns[n-1][:remainingSpace] + "..."
+		remainingSpace := max(m.width-(w+(n-1)*padding), 0)
+		if remainingSpace < len("...") {
+			columns[n-1] = ""
+		} else {
+			columns[n-1] = truncate.StringWithTail(columns[n-1], uint(remainingSpace), "...")
+		}
 	}
 
 	footer := strings.Join(columns, strings.Repeat(" ", padding))
-	footer = footerStyle.Render(footer)
+	footer = m.styles.footer.Render(footer)
 	if m.help.ShowAll {
 		return "\n" + m.help.View(m.keymap) + "\n" + footer
 	}
 	return footer
 }
 
+// shortTokens formats a token count like 128k or 1M.
+func shortTokens(n int) string {
+	switch {
+	case n >= 1_000_000:
+		return strings.TrimSuffix(fmt.Sprintf("%.1f", float64(n)/1_000_000), ".0") + "M"
+	case n >= 1000:
+		return fmt.Sprintf("%dk", n/1000)
+	}
+	return fmt.Sprint(n)
+}
+
 func (m Model) View() string {
 	if m.width == 0 || m.height == 0 {
 		return "Initializing..."
@@ -0,0 +1,241 @@
+package chatgpt
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"reflect"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	tea "github.com/charmbracelet/bubbletea"
+	glamourstyles "github.com/charmbracelet/glamour/styles"
+	"github.com/sashabaranov/go-openai"
+)
+
+// ConfigProblem is an issue found in the config file.
+type ConfigProblem struct {
+	File    string
+	Line    int
+	Key     string
+	Message string
+	// Warnings don't prevent the config from being used.
+	Warning bool
+}
+
+func (p ConfigProblem) String() string {
+	level := "error"
+	if p.Warning {
+		level = "warning"
+	}
+	pos := p.File
+	if p.Line > 0 {
+		pos = fmt.Sprintf("%s:%d", p.File, p.Line)
+	}
+	if p.Key == "" {
+		return fmt.Sprintf("%s: %s: %s", pos, level, p.Message)
+	}
+	return fmt.Sprintf("%s: %s: %s: %s", pos, level, p.Key, p.Message)
+}
+
+// ValidateConfig checks the config file for unknown keys, unset environment variables, invalid key bindings,
+// unknown models and out of range values. The error is returned when the file can't be read or parsed.
+func ValidateConfig() ([]ConfigProblem, error) {
+	path := ConfigFile()
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+	src, err := parseConfigFile(path, data)
+	if err != nil {
+		return nil, err
+	}
+
+	var problems []ConfigProblem
+	report := func(key string, warning bool, format string, args ...any) {
+		problems = append(
+			problems, ConfigProblem{
+				File:    path,
+				Line:    src.line(key),
+				Key:     key,
+				Message: fmt.Sprintf(format, args...),
+				Warning: warning,
+			},
+		)
+	}
+
+	problems = append(problems, src.warnings()...)
+
+	conf, err := LoadConfig()
+	if err != nil {
+		problems = append(problems, ConfigProblem{File: path, Message: err.Error()})
+		return sortProblems(problems), nil
+	}
+
+	switch openai.APIType(strings.ToUpper(string(conf.APIType))) {
+	case openai.APITypeOpenAI, openai.APITypeAzure, openai.APITypeAzureAD:
+	default:
+		report("api_type", false, "unknown API type %q", conf.APIType)
+	}
+	if conf.Profile != "" {
+		if _, ok := conf.Profiles[conf.Profile]; !ok {
+			report("profile", false, "unknown profile %q", conf.Profile)
+		}
+	}
+
+	validateKeyMap(conf.KeyMap, report)
+
+	models := slices.Clone(knownModels)
+	for m := range conf.ModelMapping {
+		models = append(models, m)
+	}
+	for _, p := range conf.Profiles {
+		for m := range p.ModelMapping {
+			models = append(models, m)
+		}
+	}
+	known := func(model string) bool {
+		return slices.Contains(models, model) || conf.isKnownModel(model)
+	}
+	checkConversation := func(prefix string, c ConversationConfig, present func(key string) bool) {
+		if present("model") && c.Model != "" && !known(c.Model) {
+			report(prefix+".model", true, "unknown model %q", c.Model)
+		}
+		if present("temperature") && (c.Temperature < 0 || c.Temperature > 2) {
+			report(prefix+".temperature", false, "temperature must be between 0 and 2, got %v", c.Temperature)
+		}
+		if present("context_length") && c.ContextLength < 0 {
+			report(prefix+".context_length", false, "must not be negative")
+		}
+		if present("max_tokens") && c.MaxTokens < 0 {
+			report(prefix+".max_tokens", false, "must not be negative")
+		}
+	}
+	checkConversation("conversation", conf.Conversation, func(string) bool { return true })
+	// Only the fields set in profiles are checked, the others are inherited.
+	for _, name := range conf.ProfileNames() {
+		prefix := "profiles." + name + ".conversation"
+		p, err := conf.WithProfile(name)
+		if err != nil {
+			report(prefix, false, "%v", err)
+			continue
+		}
+		present := func(key string) bool {
+			_, ok := src.lines[prefix+"."+key]
+			return ok
+		}
+		checkConversation(prefix, p.Conversation, present)
+	}
+
+	for _, name := range slices.Sorted(maps.Keys(conf.PromptLibrary)) {
+		p := conf.PromptLibrary[name]
+		if p.Model != "" && !known(p.Model) {
+			problems = append(
+				problems,
+				ConfigProblem{File: p.Path, Key: "model", Message: fmt.Sprintf("unknown model %q", p.Model), Warning: true},
+			)
+		}
+	}
+
+	for name, info := range conf.Models {
+		if !validModelPattern(name) {
+			report("models."+name, false, "invalid pattern")
+		}
+		for _, f := range info.Features {
+			if !slices.Contains(modelFeatures, f) {
+				report("models."+name+".features", false, "unknown feature %q", f)
+			}
+		}
+	}
+	for name, server := range conf.MCPServers {
+		if (server.Command == "") == (server.URL == "") {
+			report("mcp_servers."+name, false, "exactly one of command and url is required")
+		}
+	}
+	if conf.Theme.Name != "" && !slices.Contains(Themes, conf.Theme.Name) {
+		report("theme.name", false, "unknown theme %q, must be one of %s", conf.Theme.Name, strings.Join(Themes, ", "))
+	}
+	if style := conf.Theme.GlamourStyle; style != "" && style != "auto" && glamourstyles.DefaultStyles[style] == nil {
+		if _, err := os.Stat(style); err != nil {
+			report("theme.glamour_style", false, "%q is neither a glamour style nor a style file", style)
+		}
+	}
+	colors := map[string]string{
+		"user":    conf.Theme.Colors.User,
+		"bot":     conf.Theme.Colors.Bot,
+		"error":   conf.Theme.Colors.Error,
+		"confirm": conf.Theme.Colors.Confirm,
+		"border":  conf.Theme.Colors.Border,
+	}
+	for name, color := range colors {
+		if color != "" && !colorRe.MatchString(color) {
+			report("theme.colors."+name, false, "invalid color %q, must be an ANSI color number or a hex color", color)
+		}
+	}
+	if conf.FrameRate < 0 {
+		report("frame_rate", false, "must not be negative")
+	}
+	if conf.Retry.MaxAttempts < 1 {
+		report("retry.max_attempts", false, "must be at least 1")
+	}
+	return sortProblems(problems), nil
+}
+
+var colorRe = regexp.MustCompile(`^(\d{1,3}|#[0-9a-fA-F]{3}|#[0-9a-fA-F]{6})$`)
+
+func sortProblems(problems []ConfigProblem) []ConfigProblem {
+	sort.SliceStable(
+		problems, func(i, j int) bool {
+			if problems[i].Line != problems[j].Line {
+				return problems[i].Line < problems[j].Line
+			}
+			return problems[i].Key < problems[j].Key
+		},
+	)
+	return problems
+}
+
+// keyNames are the names of the special keys, as used in key bindings.
+var keyNames = func() map[string]bool {
+	names := map[string]bool{}
+	for k := tea.KeyType(-200); k < 200; k++ {
+		if name := k.String(); name != "" && name != "runes" {
+			names[name] = true
+		}
+	}
+	return names
+}()
+
+// ValidKey reports whether the key binding can be produced by the terminal, e.g. "ctrl+d", "alt+enter" or "q".
+func ValidKey(key string) bool {
+	key = strings.TrimPrefix(key, "alt+")
+	return keyNames[key] || utf8.RuneCountInString(key) == 1
+}
+
+func validateKeyMap(keys KeyMapConfig, report func(key string, warning bool, format string, args ...any)) {
+	v := reflect.ValueOf(keys)
+	fields := jsonFields(v.Type())
+	names := make([]string, 0, len(fields))
+	for name := range fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		keys := v.FieldByIndex(fields[name].Index).Interface().([]string)
+		if len(keys) == 0 {
+			report("key_map."+name, false, "no keys are bound")
+		}
+		for _, k := range keys {
+			if !ValidKey(k) {
+				report("key_map."+name, false, "invalid key %q", k)
+			}
+		}
+	}
+}